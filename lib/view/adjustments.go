@@ -0,0 +1,195 @@
+package view
+
+import (
+	"fmt"
+	"math"
+)
+
+// Adjustment is one of the view adjustments, the selected one is changed with
+// the adjust commands
+type Adjustment int
+
+const (
+	AdjustBrightness Adjustment = iota
+	AdjustContrast
+	AdjustGamma
+	AdjustSaturation
+	// AdjustBlackPoint and AdjustWhitePoint are the levels, the display
+	// values that are stretched to black and white
+	AdjustBlackPoint
+	AdjustWhitePoint
+
+	adjustmentCount
+)
+
+var adjustmentNames = map[Adjustment]string{
+	AdjustBrightness: "brightness",
+	AdjustContrast:   "contrast",
+	AdjustGamma:      "gamma",
+	AdjustSaturation: "saturation",
+	AdjustBlackPoint: "black point",
+	AdjustWhitePoint: "white point",
+}
+
+// adjustmentRange is the step and limits of an adjustment, and the neutral
+// value that is stored as zero. The limits are shown values, not offsets.
+type adjustmentRange struct {
+	step, min, max float64
+	neutral        float64
+}
+
+var adjustmentRanges = map[Adjustment]adjustmentRange{
+	AdjustBrightness: {step: 0.05, min: -1, max: 1},
+	AdjustContrast:   {step: 0.1, min: 0, max: 4, neutral: 1},
+	AdjustGamma:      {step: 0.1, min: 0.1, max: 5, neutral: 1},
+	AdjustSaturation: {step: 0.1, min: 0, max: 4, neutral: 1},
+	AdjustBlackPoint: {step: 0.02, min: 0, max: 1},
+	AdjustWhitePoint: {step: 0.02, min: 0, max: 1, neutral: 1},
+}
+
+// minLevelsRange is the least distance between the black and white point
+const minLevelsRange = 0.02
+
+func (a Adjustment) String() string {
+	name, ok := adjustmentNames[a]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(a))
+	}
+	return name
+}
+
+func (a Adjustment) Next() Adjustment {
+	return (a + 1) % adjustmentCount
+}
+
+// Adjustments change the display values of an image without changing the
+// file. Brightness is added, contrast scales around middle grey and
+// saturation scales the distance to the luminance. Every value is stored as
+// an offset from its neutral value, so the zero value changes nothing: the
+// contrast is 1+Contrast and the white point 1+WhitePoint for example.
+type Adjustments struct {
+	Brightness float64
+	Contrast   float64
+	Gamma      float64
+	Saturation float64
+	BlackPoint float64
+	WhitePoint float64
+}
+
+var DefaultAdjustments = Adjustments{}
+
+func (a *Adjustments) value(adjustment Adjustment) *float64 {
+	switch adjustment {
+	case AdjustBrightness:
+		return &a.Brightness
+	case AdjustContrast:
+		return &a.Contrast
+	case AdjustGamma:
+		return &a.Gamma
+	case AdjustSaturation:
+		return &a.Saturation
+	case AdjustBlackPoint:
+		return &a.BlackPoint
+	case AdjustWhitePoint:
+		return &a.WhitePoint
+	}
+	return nil
+}
+
+// Adjust changes an adjustment by a number of steps, within its limits
+func (a *Adjustments) Adjust(adjustment Adjustment, steps float64) {
+	value := a.value(adjustment)
+	r, ok := adjustmentRanges[adjustment]
+	if value == nil || !ok {
+		return
+	}
+
+	low, high := r.min, r.max
+	switch adjustment {
+	case AdjustBlackPoint:
+		high = a.Shown(AdjustWhitePoint) - minLevelsRange
+	case AdjustWhitePoint:
+		low = a.Shown(AdjustBlackPoint) + minLevelsRange
+	}
+
+	// rounded to the step, so repeated steps do not drift
+	v := math.Round((*value+r.neutral+steps*r.step)/r.step) * r.step
+	*value = min(max(v, low), high) - r.neutral
+}
+
+// Shown returns the value of an adjustment as it is shown and applied,
+// instead of its offset from the neutral value
+func (a *Adjustments) Shown(adjustment Adjustment) float64 {
+	value := a.value(adjustment)
+	if value == nil {
+		return 0
+	}
+	return *value + adjustmentRanges[adjustment].neutral
+}
+
+func (a *Adjustments) IsDefault() bool {
+	return *a == DefaultAdjustments
+}
+
+// Lines describes the adjustments, marking the selected one
+func (a *Adjustments) Lines(selected Adjustment) []string {
+	lines := make([]string, 0, adjustmentCount)
+	for adjustment := Adjustment(0); adjustment < adjustmentCount; adjustment++ {
+		marker := "  "
+		if adjustment == selected {
+			marker = "> "
+		}
+		lines = append(lines, fmt.Sprintf("%s%-11s %.2f", marker, adjustment, a.Shown(adjustment)))
+	}
+	return lines
+}
+
+// Apply changes display values in 0..1, matching the image shader
+func (a *Adjustments) Apply(c [4]float64) [4]float64 {
+	white := 1 + a.WhitePoint
+	var rgb [3]float64
+	for channel := range rgb {
+		v := (c[channel] - a.BlackPoint) / (white - a.BlackPoint)
+		v = (v-0.5)*(1+a.Contrast) + 0.5 + a.Brightness
+		rgb[channel] = math.Pow(min(max(v, 0), 1), 1/(1+a.Gamma))
+	}
+
+	luminance := 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+	for channel := range rgb {
+		c[channel] = min(max(luminance+(rgb[channel]-luminance)*(1+a.Saturation), 0), 1)
+	}
+	return c
+}
+
+var (
+	AdjustmentsBackgroundColor = NewColor(0, 0, 0, 0.7)
+	AdjustmentsTextColor       = NewColor(1, 1, 1, 0.9)
+)
+
+const AdjustmentsPadding = 8
+
+// DrawAdjustments shows the adjustments in the top left corner of the window
+// while they are changed from the defaults or one is being selected
+func (m *Main) DrawAdjustments() {
+	if m.Adjustments.IsDefault() && !m.adjusting {
+		return
+	}
+
+	lines := m.Adjustments.Lines(m.adjustment)
+	if m.Settings.StickyAdjustments {
+		lines = append(lines, "  sticky")
+	}
+
+	var w float64
+	for _, line := range lines {
+		lineW, _ := TextSize(line)
+		w = math.Max(w, lineW)
+	}
+	h := float64(len(lines))*LineHeight() - (LineHeight() - fontGlyphH*TextScale)
+
+	rect := NewRect(AdjustmentsPadding, AdjustmentsPadding, w+2*AdjustmentsPadding, h+2*AdjustmentsPadding)
+	m.Renderer.DrawQuad(rect, AdjustmentsBackgroundColor)
+	for i, line := range lines {
+		m.Renderer.DrawText(line, rect.X+AdjustmentsPadding, rect.Y+AdjustmentsPadding+float64(i)*LineHeight(), AdjustmentsTextColor)
+	}
+}
@@ -0,0 +1,45 @@
+package view
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAdjustmentsZeroValue(t *testing.T) {
+	var a Adjustments
+	for _, c := range [][4]float64{{0, 0, 0, 1}, {0.25, 0.5, 0.75, 0.5}, {1, 1, 1, 0}} {
+		result := a.Apply(c)
+		for channel := range c {
+			if math.Abs(result[channel]-c[channel]) > 1e-12 {
+				t.Errorf("%v changed to %v", c, result)
+				break
+			}
+		}
+	}
+}
+
+func TestAdjustmentsAdjust(t *testing.T) {
+	tests := []struct {
+		name       string
+		adjustment Adjustment
+		steps      float64
+		expected   float64
+	}{
+		{"contrast", AdjustContrast, 3, 1.3},
+		{"contrast limit", AdjustContrast, -20, 0},
+		{"gamma limit", AdjustGamma, -20, 0.1},
+		{"saturation", AdjustSaturation, -10, 0},
+		{"white point", AdjustWhitePoint, -5, 0.9},
+		{"white point above black point", AdjustWhitePoint, -60, minLevelsRange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var a Adjustments
+			a.Adjust(test.adjustment, test.steps)
+			if shown := a.Shown(test.adjustment); math.Abs(shown-test.expected) > 1e-9 {
+				t.Errorf("%s is %g, expected %g", test.adjustment, shown, test.expected)
+			}
+		})
+	}
+}
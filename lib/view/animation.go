@@ -0,0 +1,35 @@
+package view
+
+import "time"
+
+// FrameInterval is the time between frames while an animation is running
+var FrameInterval = time.Second / 60
+
+// Animation changes the view over time, it is advanced once before every
+// frame for as long as it is running.
+type Animation interface {
+	// Animate updates the view for the frame drawn at now and reports
+	// whether the animation continues
+	Animate(m *Main, now time.Time) bool
+}
+
+// StartAnimation runs an animation from the next frame on
+func (m *Main) StartAnimation(a Animation) {
+	m.animations = append(m.animations, a)
+	m.Invalidate()
+}
+
+// Animating reports whether any animation is running
+func (m *Main) Animating() bool {
+	return len(m.animations) != 0
+}
+
+func (m *Main) animate(now time.Time) {
+	running := m.animations[:0]
+	for _, a := range m.animations {
+		if a.Animate(m, now) {
+			running = append(running, a)
+		}
+	}
+	m.animations = running
+}
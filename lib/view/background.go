@@ -0,0 +1,95 @@
+package view
+
+import (
+	"fmt"
+	"math"
+)
+
+// Background is the color of the window around the image
+type Background int
+
+const (
+	BackgroundDark Background = iota
+	BackgroundLight
+	BackgroundBlack
+	BackgroundWhite
+	// BackgroundCustom uses the color from the settings
+	BackgroundCustom
+
+	backgroundCount
+)
+
+var backgroundNames = map[Background]string{
+	BackgroundDark:   "dark",
+	BackgroundLight:  "light",
+	BackgroundBlack:  "black",
+	BackgroundWhite:  "white",
+	BackgroundCustom: "custom",
+}
+
+var BackgroundColors = map[Background]Color{
+	BackgroundDark:  NewColor(0.2, 0.2, 0.2, 1),
+	BackgroundLight: NewColor(0.8, 0.8, 0.8, 1),
+	BackgroundBlack: NewColor(0, 0, 0, 1),
+	BackgroundWhite: NewColor(1, 1, 1, 1),
+}
+
+func (b Background) String() string {
+	name, ok := backgroundNames[b]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(b))
+	}
+	return name
+}
+
+func (b Background) Next() Background {
+	return (b + 1) % backgroundCount
+}
+
+type CheckerboardSettings struct {
+	// Enabled draws the checkerboard behind the image, so transparent
+	// pixels can be told apart from the background
+	Enabled bool
+	// Size is the width and height of a square in window pixels
+	Size  float64
+	Light Color
+	Dark  Color
+}
+
+// checkerboardDark reports whether the position x, y relative to the first
+// light square lies on a dark square, like the quad shader
+func checkerboardDark(x, y, size float64) bool {
+	return math.Mod(math.Floor(x/size)+math.Floor(y/size), 2) != 0
+}
+
+func (m *Main) backgroundColor() Color {
+	if m.Settings.Background == BackgroundCustom {
+		return m.Settings.CustomBackground
+	}
+	color, ok := BackgroundColors[m.Settings.Background]
+	if !ok {
+		return BackgroundColors[BackgroundDark]
+	}
+	return color
+}
+
+// drawCheckerboard fills the part of the bounds of t within clip, both in
+// the untransformed coordinates of view. The squares are aligned to the top
+// left corner of the image.
+func (m *Main) drawCheckerboard(t *Texture, view View, clip Rect) {
+	settings := m.Settings.Checkerboard
+	if !settings.Enabled || settings.Size <= 0 {
+		return
+	}
+
+	bounds := t.Bounds(view.X, view.Y, view.Scale)
+	left := math.Max(bounds.X, clip.X)
+	top := math.Max(bounds.Y, clip.Y)
+	right := math.Min(bounds.X2(), clip.X2())
+	bottom := math.Min(bounds.Y2(), clip.Y2())
+	if right <= left || bottom <= top {
+		return
+	}
+
+	m.Renderer.DrawCheckerboard(NewRect(left, top, right-left, bottom-top), bounds.X, bounds.Y, settings.Size, settings.Light, settings.Dark)
+}
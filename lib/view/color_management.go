@@ -0,0 +1,89 @@
+package view
+
+import "math"
+
+const (
+	sourceCurveSize  = 1024
+	displayCurveSize = 4096
+)
+
+// ColorManagement converts images from their embedded (or assumed sRGB)
+// profile to the display profile.
+type ColorManagement struct {
+	Enabled bool
+	Display *ColorProfile
+}
+
+// colorConversion holds the tone curve lookup tables and primaries matrix
+// from a source to a display profile, as used by the renderers. The tables
+// store size RGB samples of the curves over 0 to 1.
+type colorConversion struct {
+	source, display *ColorProfile
+
+	sourceCurves  []float32
+	displayCurves []float32
+	matrix        [9]float64
+}
+
+// update prepares the conversion between two profiles, a nil source is
+// treated as sRGB. It reports whether anything changed; the tables are only
+// rebuilt for the profiles that differ from the previous call.
+func (c *colorConversion) update(source, display *ColorProfile) bool {
+	if source == nil {
+		source = SRGBProfile
+	}
+	if source == c.source && display == c.display {
+		return false
+	}
+
+	if source != c.source {
+		c.sourceCurves = newCurveTable(sourceCurveSize, func(channel int, x float64) float64 {
+			return source.Curves[channel].Eval(x)
+		})
+	}
+	if display != c.display {
+		c.displayCurves = newCurveTable(displayCurveSize, func(channel int, x float64) float64 {
+			return InvertToneCurve(display.Curves[channel], x)
+		})
+	}
+	c.source = source
+	c.display = display
+	c.matrix = source.ConversionMatrix(display)
+
+	return true
+}
+
+func newCurveTable(size int, curve func(channel int, x float64) float64) []float32 {
+	data := make([]float32, size*3)
+	for i := 0; i < size; i++ {
+		x := float64(i) / float64(size-1)
+		for channel := 0; channel < 3; channel++ {
+			data[i*3+channel] = float32(curve(channel, x))
+		}
+	}
+	return data
+}
+
+// lookupCurve linearly interpolates a curve table, like the 1D textures in
+// the image shader.
+func lookupCurve(table []float32, channel int, x float64) float64 {
+	size := len(table) / 3
+	position := min(max(x, 0), 1) * float64(size-1)
+	i := min(int(position), size-2)
+	f := position - float64(i)
+	return float64(table[i*3+channel])*(1-f) + float64(table[(i+1)*3+channel])*f
+}
+
+func srgbToLinear(c float64) float64 {
+	if c < 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(c float64) float64 {
+	if c < 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
@@ -2,18 +2,48 @@ package view
 
 import (
 	"log"
+	"math"
 	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
 )
 
 type QuitCommand struct{}
+type RedrawCommand struct{}
 type ZoomCommand struct {
 	Scale float64
+	// Held is set when the zoom continues until a StopZoomCommand, Repeat
+	// for the key repeats that follow
+	Held   bool
+	Repeat bool
 }
+type StopZoomCommand struct{}
 type ZoomToMouseCursorCommand struct {
 	Scale float64
 }
-type ZoomOriginalSizeCommand struct{}
-type ZoomFitToWindowCommand struct{}
+type FitCommand struct {
+	Mode FitMode
+}
+type CycleFitModeCommand struct{}
+type ToggleNavigatorCommand struct{}
+type ShowLoupeCommand struct{}
+type HideLoupeCommand struct{}
+type ToggleLoupeShapeCommand struct{}
+type ToggleInspectorCommand struct{}
+type ToggleHistogramCommand struct{}
+type CycleDisplayModeCommand struct{}
+
+// DisplayModeCommand switches to a display mode, or back to normal when it
+// is active already
+type DisplayModeCommand struct {
+	Mode DisplayMode
+}
+type CopyPixelCommand struct{}
+type LoupeFactorCommand struct {
+	Scale float64
+}
+type ToggleLockViewCommand struct{}
+type ToggleRememberViewsCommand struct{}
 type FirstFileCommand struct{}
 type LastFileCommand struct{}
 type NextFileCommand struct{}
@@ -32,43 +62,91 @@ type StartDragLeftCommand struct{}
 type StopDragLeftCommand struct{}
 type StartDragRightCommand struct{}
 type StopDragRightCommand struct{}
+type ExposureCommand struct {
+	EV float64
+}
+type ResetExposureCommand struct{}
+type CycleToneMapOperatorCommand struct{}
+type ToggleColorManagementCommand struct{}
+type CycleTextureFilterCommand struct{}
+type TogglePixelGridCommand struct{}
+type ToggleFullscreenCommand struct{}
+type HideCursorCommand struct{}
+type CycleBackgroundCommand struct{}
+type ToggleCheckerboardCommand struct{}
+type ToggleCompareCommand struct{}
+type SwapCompareCommand struct{}
+type CycleAdjustmentCommand struct{}
+type AdjustCommand struct {
+	Steps float64
+}
+type ResetAdjustmentsCommand struct{}
+type ToggleStickyAdjustmentsCommand struct{}
+type RotateCommand struct {
+	Degrees float64
+}
+type ResetRotationCommand struct{}
+type FlipHorizontalCommand struct{}
+type FlipVerticalCommand struct{}
+type SaveOrientationCommand struct{}
 
+// CommandHandler applies the commands translated from SDL events on the main
+// thread, and those sent on commandChannel by other goroutines.
 type CommandHandler struct {
 	main           *Main
 	commandChannel <-chan interface{}
+	inputHandler   *InputHandler
 }
 
-func NewCommandHandler(main *Main, commandChannel <-chan interface{}) *CommandHandler {
-	return &CommandHandler{main: main, commandChannel: commandChannel}
+func NewCommandHandler(main *Main, commandChannel <-chan interface{}, inputHandler *InputHandler) *CommandHandler {
+	return &CommandHandler{main: main, commandChannel: commandChannel, inputHandler: inputHandler}
 }
 
-func (h *CommandHandler) HandleCommand(command interface{}) (waitForCommand bool) {
+// HandleCommand applies a command and reports whether the view has to be
+// drawn again.
+func (h *CommandHandler) HandleCommand(command interface{}) (dirty bool) {
+	dirty = true
+
 	switch c := command.(type) {
 	case QuitCommand:
 		h.main.Running = false
 
+	case RedrawCommand:
+
 	case ZoomCommand:
-		h.main.View.Scale *= c.Scale
+		switch {
+		case h.main.Settings.ZoomDuration <= 0:
+			h.main.ZoomAt(h.main.View.X, h.main.View.Y, c.Scale)
+		case c.Repeat:
+			// a held key zooms continuously
+			dirty = false
+		default:
+			h.main.AnimateZoom(0, 0, true, c.Scale, c.Held)
+		}
+
+	case StopZoomCommand:
+		h.main.StopZoom()
+		dirty = false
 
 	case ZoomToMouseCursorCommand:
+		x, y := h.main.Mouse.X, h.main.Mouse.Y
 		if c.Scale < 1 {
-			h.main.View.X += (h.main.View.W/2 - h.main.View.X) * (1 - c.Scale)
-			h.main.View.Y += (h.main.View.H/2 - h.main.View.Y) * (1 - c.Scale)
+			x, y = h.main.View.W/2, h.main.View.H/2
+		}
+		if h.main.Settings.ZoomDuration <= 0 {
+			h.main.ZoomAt(x, y, c.Scale)
 		} else {
-			h.main.View.X += (h.main.Mouse.X - h.main.View.X) * (1 - c.Scale)
-			h.main.View.Y += (h.main.Mouse.Y - h.main.View.Y) * (1 - c.Scale)
+			h.main.AnimateZoom(x, y, false, c.Scale, false)
 		}
-		h.main.View.Scale *= c.Scale
 
-	case ZoomOriginalSizeCommand:
-		h.main.View.X = h.main.View.W / 2
-		h.main.View.Y = h.main.View.H / 2
-		h.main.View.Scale = 1
+	case FitCommand:
+		h.main.Fit(c.Mode)
 
-	case ZoomFitToWindowCommand:
-		h.main.View.X = h.main.View.W / 2
-		h.main.View.Y = h.main.View.H / 2
-		h.main.FitToWindow()
+	case CycleFitModeCommand:
+		h.main.Settings.FitMode = h.main.Settings.FitMode.Next()
+		h.main.Fit(h.main.Settings.FitMode)
+		h.main.UpdateWindowTitle()
+		h.main.SaveSettings()
 
 	case FirstFileCommand:
 		h.main.FileCursor.First()
@@ -78,6 +156,68 @@ func (h *CommandHandler) HandleCommand(command interface{}) (waitForCommand bool
 		h.main.FileCursor.Last()
 		_ = h.main.LoadFile()
 
+	case ToggleNavigatorCommand:
+		h.main.Settings.Navigator.Enabled = !h.main.Settings.Navigator.Enabled
+		h.main.SaveSettings()
+
+	case ShowLoupeCommand:
+		dirty = !h.main.Loupe
+		h.main.Loupe = true
+
+	case HideLoupeCommand:
+		dirty = h.main.Loupe
+		h.main.Loupe = false
+
+	case ToggleLoupeShapeCommand:
+		h.main.Settings.Loupe.Round = !h.main.Settings.Loupe.Round
+		h.main.SaveSettings()
+
+	case LoupeFactorCommand:
+		h.main.Settings.Loupe.Factor = math.Max(1, h.main.Settings.Loupe.Factor*c.Scale)
+		h.main.SaveSettings()
+
+	case ToggleInspectorCommand:
+		h.main.Inspector = !h.main.Inspector
+
+	case CopyPixelCommand:
+		h.main.CopyPixel()
+		dirty = false
+
+	case CycleDisplayModeCommand:
+		h.main.DisplayMode = h.main.DisplayMode.Next()
+		h.main.UpdateWindowTitle()
+
+	case DisplayModeCommand:
+		if h.main.DisplayMode == c.Mode {
+			h.main.DisplayMode = DisplayNormal
+		} else {
+			h.main.DisplayMode = c.Mode
+		}
+		h.main.UpdateWindowTitle()
+
+	case ToggleHistogramCommand:
+		h.main.Settings.Histogram = !h.main.Settings.Histogram
+		h.main.SaveSettings()
+
+	case HistogramCommand:
+		// the file may have changed while it was computed
+		if c.Texture != h.main.Texture {
+			dirty = false
+			break
+		}
+		h.main.histogram = c.Histogram
+		dirty = h.main.Settings.Histogram
+
+	case ToggleLockViewCommand:
+		h.main.LockView = !h.main.LockView
+		h.main.UpdateWindowTitle()
+		dirty = false
+
+	case ToggleRememberViewsCommand:
+		h.main.Settings.RememberViews = !h.main.Settings.RememberViews
+		h.main.SaveSettings()
+		dirty = false
+
 	case NextFileCommand:
 		h.main.FileCursor.Next()
 		_ = h.main.LoadFile()
@@ -87,32 +227,50 @@ func (h *CommandHandler) HandleCommand(command interface{}) (waitForCommand bool
 		_ = h.main.LoadFile()
 
 	case UpdateWindowSizeCommand:
-		h.main.ResetGLView(c.W, c.H)
+		h.main.ResetView(c.W, c.H)
 
 	case SaveSettingsCommand:
 		h.main.SaveSettings()
-		waitForCommand = true
+		dirty = false
 
 	case MouseCursorPositionCommand:
+		// both panes share the view, so positions are relative to the pane
+		c.X = h.main.paneMouseX(c.X)
 		if h.main.Mouse.DragRight.Dragging {
 			h.main.View.X += c.X - h.main.Mouse.X
 			h.main.View.Y += c.Y - h.main.Mouse.Y
+			h.main.TrackPan(c.X-h.main.Mouse.X, c.Y-h.main.Mouse.Y)
 		}
 
 		h.main.Mouse.X = c.X
 		h.main.Mouse.Y = c.Y
+		h.main.ShowCursor()
 
-		waitForCommand = !h.main.Mouse.DragLeft.Dragging && !h.main.Mouse.DragRight.Dragging
+		if h.main.Mouse.Navigating {
+			h.main.NavigateTo(c.X, c.Y)
+		}
+
+		dirty = h.main.Mouse.DragLeft.Dragging || h.main.Mouse.DragRight.Dragging || h.main.Mouse.Navigating || h.main.Loupe || h.main.Inspector
 
 	case StartDragLeftCommand:
+		if h.main.NavigatorContains(h.main.Mouse.X, h.main.Mouse.Y) {
+			h.main.Mouse.Navigating = true
+			h.main.NavigateTo(h.main.Mouse.X, h.main.Mouse.Y)
+			break
+		}
 		h.main.Mouse.DragLeft = MouseDrag{
 			Dragging: true,
 			X:        h.main.Mouse.X,
 			Y:        h.main.Mouse.Y,
 		}
-		waitForCommand = true
+		dirty = false
 
 	case StopDragLeftCommand:
+		if h.main.Mouse.Navigating {
+			h.main.Mouse.Navigating = false
+			dirty = false
+			break
+		}
 		h.main.Mouse.DragLeft.Dragging = false
 
 		dragRect := h.main.Mouse.DragLeftRect()
@@ -121,6 +279,8 @@ func (h *CommandHandler) HandleCommand(command interface{}) (waitForCommand bool
 			break
 		}
 
+		// the zoom scales the window around a point, so it is the same for
+		// rotated and flipped images
 		dragRatio := dragRect.W / dragRect.H
 		windowRatio := h.main.View.W / h.main.View.H
 
@@ -132,74 +292,198 @@ func (h *CommandHandler) HandleCommand(command interface{}) (waitForCommand bool
 		}
 
 		// zoom in
-		h.main.View.X += ((dragRect.X + dragRect.W/2) - h.main.View.X) * (1 - scale)
-		h.main.View.Y += ((dragRect.Y + dragRect.H/2) - h.main.View.Y) * (1 - scale)
+		h.main.StopViewAnimations()
+		h.main.ZoomAt(dragRect.X+dragRect.W/2, dragRect.Y+dragRect.H/2, scale)
 
 		// move to center
 		h.main.View.X += h.main.View.W/2 - (dragRect.X + dragRect.W/2)
 		h.main.View.Y += h.main.View.H/2 - (dragRect.Y + dragRect.H/2)
 
-		h.main.View.Scale *= scale
-
 	case StartDragRightCommand:
+		h.main.StopKineticPan()
 		h.main.Mouse.DragRight = MouseDrag{
 			Dragging: true,
 			X:        h.main.Mouse.X,
 			Y:        h.main.Mouse.Y,
 		}
-		waitForCommand = true
+		dirty = false
 
 	case StopDragRightCommand:
 		h.main.Mouse.DragRight.Dragging = false
-		waitForCommand = true
+		h.main.StartKineticPan()
+		dirty = false
 
 	case MoveViewCommand:
 		h.main.View.X += c.X
 		h.main.View.Y += c.Y
 
+	case ExposureCommand:
+		h.main.ToneMapping.AdjustExposure(c.EV)
+		h.main.UpdateWindowTitle()
+
+	case ResetExposureCommand:
+		h.main.ToneMapping.Exposure = 0
+		h.main.UpdateWindowTitle()
+
+	case CycleToneMapOperatorCommand:
+		h.main.ToneMapping.Operator = h.main.ToneMapping.Operator.Next()
+		h.main.UpdateWindowTitle()
+		h.main.SaveSettings()
+
+	case ToggleColorManagementCommand:
+		h.main.ColorManagement.Enabled = !h.main.ColorManagement.Enabled
+		h.main.UpdateWindowTitle()
+		h.main.SaveSettings()
+
+	case CycleTextureFilterCommand:
+		h.main.TextureFilter = h.main.TextureFilter.Next()
+		h.main.UpdateWindowTitle()
+		h.main.SaveSettings()
+
+	case TogglePixelGridCommand:
+		h.main.Settings.PixelGrid.Enabled = !h.main.Settings.PixelGrid.Enabled
+		h.main.SaveSettings()
+
+	case ToggleFullscreenCommand:
+		h.main.SetFullscreen(!h.main.Fullscreen)
+		h.main.SaveSettings()
+
+	case HideCursorCommand:
+		h.main.HideCursor()
+		dirty = false
+
+	case CycleBackgroundCommand:
+		h.main.Settings.Background = h.main.Settings.Background.Next()
+		h.main.SaveSettings()
+
+	case CycleAdjustmentCommand:
+		if h.main.adjusting {
+			h.main.adjustment = h.main.adjustment.Next()
+		}
+		h.main.adjusting = true
+
+	case AdjustCommand:
+		h.main.Adjustments.Adjust(h.main.adjustment, c.Steps)
+		h.main.adjusting = true
+		h.main.UpdateWindowTitle()
+
+	case ResetAdjustmentsCommand:
+		h.main.Adjustments = DefaultAdjustments
+		h.main.adjusting = false
+		h.main.UpdateWindowTitle()
+
+	case ToggleStickyAdjustmentsCommand:
+		h.main.Settings.StickyAdjustments = !h.main.Settings.StickyAdjustments
+		h.main.adjusting = true
+		h.main.SaveSettings()
+
+	case ToggleCompareCommand:
+		if h.main.Compare != nil {
+			h.main.StopCompare()
+		} else {
+			h.main.StartCompare(ComparePinned, "")
+		}
+
+	case SwapCompareCommand:
+		if h.main.Compare == nil {
+			dirty = false
+			break
+		}
+		h.main.Compare.Swapped = !h.main.Compare.Swapped
+
+	case ToggleCheckerboardCommand:
+		h.main.Settings.Checkerboard.Enabled = !h.main.Settings.Checkerboard.Enabled
+		h.main.SaveSettings()
+
+	case RotateCommand:
+		h.main.View.Rotate(c.Degrees)
+
+	case ResetRotationCommand:
+		h.main.View.ResetTransform()
+
+	case FlipHorizontalCommand:
+		h.main.View.FlipHorizontal()
+
+	case FlipVerticalCommand:
+		h.main.View.FlipVertical()
+
+	case SaveOrientationCommand:
+		err := h.main.SaveOrientation()
+		if err != nil {
+			log.Printf("failed to save orientation: %s", err)
+		}
+
 	default:
 		log.Printf("unexpected command: %#v", command)
+		dirty = false
+	}
+
+	if dirty {
+		// every command that changes the view is kept within the limits
+		h.main.ConstrainView()
 	}
 
 	return
 }
 
-func (h *CommandHandler) HandleBlocking() {
-	waitForCommand := true
-	for waitForCommand {
-		select {
-		case command := <-h.commandChannel:
-			waitForCommand = h.HandleCommand(command)
+// HandleUntilDirty pumps SDL events until a command requires the view to be
+// drawn again, then handles the events and commands that are already queued
+// so they end up in the same frame. A positive timeout limits the wait, for
+// the next frame of a running animation. It has to be called from the main
+// thread, which created the window.
+func (h *CommandHandler) HandleUntilDirty(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for h.main.Running {
+		h.handleQueued()
+		if h.main.dirty {
+			h.handleEvents()
+			return
+		}
+
+		var e sdl.Event
+		if timeout > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return
+			}
+			e = sdl.WaitEventTimeout(int(remaining.Milliseconds()) + 1)
+		} else {
+			e = sdl.WaitEvent()
+		}
+
+		// wake up events only interrupt the wait, the commands they announce
+		// are handled at the start of the next iteration
+		if e != nil && e.GetType() != h.main.wakeEvent {
+			h.handleEvent(e)
+			h.handleEvents()
 		}
 	}
 }
 
-func (h *CommandHandler) HandleBlockingOrAtLeast(duration time.Duration) {
-	timeout := time.After(duration)
-	waitForCommand := true
-	breakOutHit := false
-	timeoutHit := false
-	for !timeoutHit || !breakOutHit {
-		select {
-		case command := <-h.commandChannel:
-			waitForCommand = h.HandleCommand(command)
-			if !waitForCommand {
-				breakOutHit = true
-			}
-		case <-timeout:
-			timeoutHit = true
+func (h *CommandHandler) handleEvents() {
+	for e := sdl.PollEvent(); e != nil && h.main.Running; e = sdl.PollEvent() {
+		h.handleEvent(e)
+	}
+}
+
+func (h *CommandHandler) handleEvent(e sdl.Event) {
+	for _, command := range h.inputHandler.Translate(e) {
+		if h.HandleCommand(command) {
+			h.main.Invalidate()
 		}
 	}
 }
 
-func (h *CommandHandler) HandleTimeout(timeout time.Duration) {
-	waitForCommand := true
-	for waitForCommand {
+func (h *CommandHandler) handleQueued() {
+	for h.main.Running {
 		select {
 		case command := <-h.commandChannel:
-			waitForCommand = h.HandleCommand(command)
-		case <-time.After(timeout):
-			waitForCommand = false
+			if h.HandleCommand(command) {
+				h.main.Invalidate()
+			}
+		default:
+			return
 		}
 	}
 }
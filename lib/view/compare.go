@@ -0,0 +1,227 @@
+package view
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+)
+
+var (
+	CompareDividerColor    = NewColor(0.5, 0.5, 0.5, 1)
+	CompareLabelColor      = NewColor(1, 1, 1, 0.9)
+	CompareLabelBackground = NewColor(0, 0, 0, 0.7)
+)
+
+const (
+	CompareDividerWidth = 2
+	CompareLabelPadding = 4
+)
+
+// CompareSource is where the reference image of the compare mode comes from
+type CompareSource int
+
+const (
+	// ComparePinned keeps the file that was shown when comparing started
+	ComparePinned CompareSource = iota
+	// CompareDirectory follows the current file by name in another directory
+	CompareDirectory
+)
+
+// Compare shows a reference image next to the current one. Both panes are
+// placed by the same view, so zooming and panning stay in sync.
+type Compare struct {
+	Source CompareSource
+	// Directory is where the reference files are found for CompareDirectory
+	Directory string
+	Filename  string
+
+	// Texture is nil when the reference could not be loaded
+	Texture *Texture
+	// Swapped shows the reference in the left pane
+	Swapped bool
+}
+
+// pane is a part of the window showing an image with the view moved right by
+// offset
+type pane struct {
+	texture *Texture
+	label   string
+	rect    Rect
+	offset  float64
+}
+
+func (p *pane) view(v View) View {
+	v.X += p.offset
+	return v
+}
+
+// paneWidth returns the width of a pane when comparing in a window of width w
+func paneWidth(w float64) float64 {
+	return math.Floor((w - CompareDividerWidth) / 2)
+}
+
+// panes returns the current image filling the window, or both images side
+// by side when comparing
+func (m *Main) panes() []pane {
+	current := pane{
+		texture: m.Texture,
+		label:   filepath.Base(m.Filename),
+		rect:    NewRect(0, 0, m.View.W, m.View.H),
+	}
+	if m.Compare == nil {
+		return []pane{current}
+	}
+
+	reference := pane{
+		texture: m.Compare.Texture,
+		label:   filepath.Base(m.Compare.Filename),
+		rect:    current.rect,
+	}
+	if reference.texture == nil {
+		reference.label += " (not found)"
+	}
+
+	panes := []pane{current, reference}
+	if m.Compare.Swapped {
+		panes[0], panes[1] = panes[1], panes[0]
+	}
+	panes[1].offset = m.windowW - m.View.W
+	panes[1].rect.X = panes[1].offset
+	return panes
+}
+
+// StartCompare shows the current file next to a reference, either the current
+// file itself or the file with the same name in directory
+func (m *Main) StartCompare(source CompareSource, directory string) {
+	if m.Compare != nil || m.Texture == nil {
+		return
+	}
+
+	m.Compare = &Compare{
+		Source:    source,
+		Directory: directory,
+		Filename:  m.Filename,
+	}
+	m.loadReference()
+
+	w := paneWidth(m.windowW)
+	m.View.X -= (m.View.W - w) / 2
+	m.View.W = w
+	m.ConstrainView()
+	m.UpdateWindowTitle()
+}
+
+// StopCompare shows the current file in the whole window again
+func (m *Main) StopCompare() {
+	if m.Compare == nil {
+		return
+	}
+
+	if m.Compare.Texture != nil {
+		m.Compare.Texture.Destroy()
+	}
+	m.Compare = nil
+
+	m.View.X += (m.windowW - m.View.W) / 2
+	m.View.W = m.windowW
+	m.ConstrainView()
+	m.UpdateWindowTitle()
+}
+
+// loadReference loads the reference file, for CompareDirectory that is the
+// file with the name of the current file
+func (m *Main) loadReference() {
+	c := m.Compare
+	if c.Source == CompareDirectory {
+		c.Filename = filepath.Join(c.Directory, filepath.Base(m.Filename))
+	}
+
+	if c.Texture != nil {
+		c.Texture.Destroy()
+		c.Texture = nil
+	}
+
+	t, err := m.openTexture(c.Filename)
+	if err != nil {
+		log.Printf("failed to open reference: %s", err)
+		return
+	}
+	// only the current image has a histogram, the reference does not need
+	// its pixels
+	t.pixels = nil
+	c.Texture = t
+}
+
+// paneMouseX returns the position x in the window relative to the pane it is
+// in. During a drag it stays relative to the pane the drag started in.
+func (m *Main) paneMouseX(x float64) float64 {
+	if m.Compare == nil {
+		return x
+	}
+
+	if !m.Mouse.DragLeft.Dragging && !m.Mouse.DragRight.Dragging && !m.Mouse.Navigating {
+		m.mouseRightPane = x >= m.windowW-m.View.W
+	}
+	return x - m.mousePaneOffset()
+}
+
+// mousePaneOffset returns the position of the pane the mouse is over
+func (m *Main) mousePaneOffset() float64 {
+	if m.Compare == nil || !m.mouseRightPane {
+		return 0
+	}
+	return m.windowW - m.View.W
+}
+
+// mouseTexture returns the texture of the pane the mouse is over, which is
+// nil when the reference could not be loaded
+func (m *Main) mouseTexture() *Texture {
+	panes := m.panes()
+	if len(panes) > 1 && m.mouseRightPane {
+		return panes[1].texture
+	}
+	return panes[0].texture
+}
+
+// drawCompareLabel names the file shown in a pane at the top of it
+func (m *Main) drawCompareLabel(p pane) {
+	w, h := TextSize(p.label)
+	rect := NewRect(
+		math.Round(p.rect.X+(p.rect.W-w)/2-CompareLabelPadding),
+		CompareLabelPadding,
+		w+2*CompareLabelPadding,
+		h+2*CompareLabelPadding,
+	)
+	m.Renderer.DrawQuad(rect, CompareLabelBackground)
+	m.Renderer.DrawText(p.label, rect.X+CompareLabelPadding, rect.Y+CompareLabelPadding, CompareLabelColor)
+}
+
+// drawPanes draws the image of each pane, clipped to the pane
+func (m *Main) drawPanes(options ImageOptions) {
+	panes := m.panes()
+	for _, p := range panes {
+		if p.texture == nil {
+			continue
+		}
+		if len(panes) > 1 {
+			m.Renderer.SetClip(Clip{Shape: ClipRect, Rect: p.rect})
+		}
+		m.drawView(p.texture, p.view(m.View), p.rect, options)
+	}
+	m.Renderer.SetClip(Clip{})
+
+	if len(panes) > 1 {
+		m.Renderer.DrawQuad(NewRect(m.View.W, 0, m.windowW-2*m.View.W, m.View.H), CompareDividerColor)
+		for _, p := range panes {
+			m.drawCompareLabel(p)
+		}
+	}
+}
+
+func (c *Compare) String() string {
+	if c.Source == CompareDirectory {
+		return fmt.Sprintf("comparing with %s", c.Directory)
+	}
+	return fmt.Sprintf("comparing with %s", filepath.Base(c.Filename))
+}
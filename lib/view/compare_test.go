@@ -0,0 +1,80 @@
+package view
+
+import "testing"
+
+func TestComparePanesUnderMouse(t *testing.T) {
+	current := &Texture{W: 1000, H: 1000}
+	reference := &Texture{W: 1000, H: 1000}
+
+	m := &Main{
+		Texture: current,
+		Compare: &Compare{Texture: reference},
+		View:    View{X: 99, Y: 100, W: 199, H: 200, Scale: 1},
+		windowW: 400,
+	}
+	m.Settings.Navigator = NavigatorSettings{Enabled: true, Size: 50}
+
+	// the bottom right corner of a pane, where the navigator of the left
+	// pane is drawn
+	x, y := 170.0, 170.0
+
+	tests := []struct {
+		name      string
+		windowX   float64
+		swapped   bool
+		texture   *Texture
+		navigator bool
+	}{
+		{"left pane", x, false, current, true},
+		{"right pane", x + m.windowW - m.View.W, false, reference, false},
+		{"left pane swapped", x, true, reference, true},
+		{"right pane swapped", x + m.windowW - m.View.W, true, current, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m.Compare.Swapped = test.swapped
+			paneX := m.paneMouseX(test.windowX)
+			if paneX != x {
+				t.Fatalf("position in the pane is %g, expected %g", paneX, x)
+			}
+			if texture := m.mouseTexture(); texture != test.texture {
+				t.Errorf("texture under the mouse is not the one drawn in the pane")
+			}
+			if contains := m.NavigatorContains(paneX, y); contains != test.navigator {
+				t.Errorf("navigator contains the mouse: %t, expected %t", contains, test.navigator)
+			}
+		})
+	}
+}
+
+// the navigator shows the image in the left pane, the reference when swapped
+func TestCompareNavigatorSwapped(t *testing.T) {
+	current := &Texture{W: 1000, H: 1000}
+	reference := &Texture{W: 1000, H: 500}
+
+	m := &Main{
+		Texture: current,
+		Compare: &Compare{Texture: reference, Swapped: true},
+		View:    View{X: 99, Y: 100, W: 199, H: 200, Scale: 1},
+		windowW: 400,
+	}
+	m.Settings.Navigator = NavigatorSettings{Enabled: true, Size: 50}
+
+	if texture := m.navigatorTexture(); texture != reference {
+		t.Errorf("navigator does not show the reference")
+	}
+	_, box, ok := m.navigator()
+	if !ok {
+		t.Fatalf("navigator is not shown")
+	}
+	if box.W != 50 || box.H != 25 {
+		t.Errorf("navigator is %gx%g, expected the size of the reference, 50x25", box.W, box.H)
+	}
+
+	// the reference was not found
+	m.Compare.Texture = nil
+	if _, _, ok := m.navigator(); ok {
+		t.Errorf("navigator is shown without an image in the left pane")
+	}
+}
@@ -0,0 +1,115 @@
+package view
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DeepZoomSource reads DeepZoom images, a .dzi descriptor next to a folder
+// with a subfolder of tiles for every level.
+type DeepZoomSource struct {
+	directory string
+	tileSize  int
+	overlap   int
+	format    string
+
+	// maxLevel is the DeepZoom level of the full resolution image
+	maxLevel int
+	levels   []PyramidLevel
+}
+
+type deepZoomDescriptor struct {
+	TileSize int    `xml:"TileSize,attr"`
+	Overlap  int    `xml:"Overlap,attr"`
+	Format   string `xml:"Format,attr"`
+	Size     struct {
+		Width  int `xml:"Width,attr"`
+		Height int `xml:"Height,attr"`
+	} `xml:"Size"`
+}
+
+func NewDeepZoomSource(filename string) (*DeepZoomSource, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening file: %s", err)
+	}
+	defer f.Close()
+
+	var descriptor deepZoomDescriptor
+	err = xml.NewDecoder(f).Decode(&descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("error while decoding deepzoom descriptor: %s", err)
+	}
+
+	w, h := descriptor.Size.Width, descriptor.Size.Height
+	if w <= 0 || h <= 0 || descriptor.TileSize <= 0 {
+		return nil, fmt.Errorf("invalid deepzoom descriptor")
+	}
+
+	source := &DeepZoomSource{
+		directory: strings.TrimSuffix(filename, filepath.Ext(filename)) + "_files",
+		tileSize:  descriptor.TileSize,
+		overlap:   descriptor.Overlap,
+		format:    descriptor.Format,
+		maxLevel:  int(math.Ceil(math.Log2(float64(max(w, h))))),
+	}
+
+	// every level halves the size, down to the level that fits in one tile
+	for level := source.maxLevel; level >= 0; level-- {
+		divisor := math.Exp2(float64(source.maxLevel - level))
+		source.levels = append(source.levels, PyramidLevel{
+			W:     int(math.Ceil(float64(w) / divisor)),
+			H:     int(math.Ceil(float64(h) / divisor)),
+			TileW: source.tileSize,
+			TileH: source.tileSize,
+		})
+		if float64(w)/divisor <= float64(source.tileSize) && float64(h)/divisor <= float64(source.tileSize) {
+			break
+		}
+	}
+
+	return source, nil
+}
+
+func (s *DeepZoomSource) Levels() []PyramidLevel {
+	return s.levels
+}
+
+func (s *DeepZoomSource) LoadTile(level, column, row int) (*image.NRGBA, Rect, error) {
+	filename := filepath.Join(s.directory, fmt.Sprint(s.maxLevel-level), fmt.Sprintf("%d_%d.%s", column, row, s.format))
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, Rect{}, err
+	}
+	defer f.Close()
+
+	i, _, err := image.Decode(f)
+	if err != nil {
+		return nil, Rect{}, fmt.Errorf("error while decoding %s: %s", filename, err)
+	}
+
+	// tiles include the overlap with their neighbours
+	x := column * s.tileSize
+	if column > 0 {
+		x -= s.overlap
+	}
+	y := row * s.tileSize
+	if row > 0 {
+		y -= s.overlap
+	}
+
+	bounds := i.Bounds()
+	return toNRGBA(i), NewRect(float64(x), float64(y), float64(bounds.Dx()), float64(bounds.Dy())), nil
+}
+
+func (s *DeepZoomSource) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package view
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestDeepZoom writes a descriptor for a 1001x600 image with 256 pixel
+// tiles and an overlap of 1, the tiles are added by the tests
+func writeTestDeepZoom(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.dzi")
+	descriptor := `<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" TileSize="256" Overlap="1" Format="png">
+  <Size Width="1001" Height="600"/>
+</Image>`
+	err := os.WriteFile(filename, []byte(descriptor), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return filename
+}
+
+func writeTestDeepZoomTile(t *testing.T, filename string, level, column, row, w, h int) {
+	t.Helper()
+	directory := filepath.Join(strings.TrimSuffix(filename, ".dzi")+"_files", fmt.Sprint(level))
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := os.Create(filepath.Join(directory, fmt.Sprintf("%d_%d.png", column, row)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, w, h)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestDeepZoomLevels(t *testing.T) {
+	source, err := NewDeepZoomSource(writeTestDeepZoom(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// sizes are rounded up, down to the level that fits in a tile
+	expected := []PyramidLevel{
+		{W: 1001, H: 600, TileW: 256, TileH: 256},
+		{W: 501, H: 300, TileW: 256, TileH: 256},
+		{W: 251, H: 150, TileW: 256, TileH: 256},
+	}
+	levels := source.Levels()
+	if len(levels) != len(expected) {
+		t.Fatalf("levels are %v, expected %v", levels, expected)
+	}
+	for i := range expected {
+		if levels[i] != expected[i] {
+			t.Errorf("level %d is %v, expected %v", i, levels[i], expected[i])
+		}
+	}
+	if source.maxLevel != 10 {
+		t.Errorf("full size level is %d, expected 10", source.maxLevel)
+	}
+	if columns, rows := levels[0].Columns(), levels[0].Rows(); columns != 4 || rows != 3 {
+		t.Errorf("full size level has %dx%d tiles, expected 4x3", columns, rows)
+	}
+}
+
+func TestDeepZoomLoadTile(t *testing.T) {
+	filename := writeTestDeepZoom(t)
+	source, err := NewDeepZoomSource(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// inner tiles overlap on all sides, the first ones only to the right
+	// and bottom
+	writeTestDeepZoomTile(t, filename, 10, 0, 0, 257, 257)
+	writeTestDeepZoomTile(t, filename, 10, 1, 2, 258, 89)
+	writeTestDeepZoomTile(t, filename, 9, 1, 0, 246, 257)
+
+	tests := []struct {
+		name               string
+		level, column, row int
+		expected           Rect
+	}{
+		{"first tile", 0, 0, 0, NewRect(0, 0, 257, 257)},
+		{"bottom tile", 0, 1, 2, NewRect(255, 511, 258, 89)},
+		{"smaller level", 1, 1, 0, NewRect(255, 0, 246, 257)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tile, rect, err := source.LoadTile(test.level, test.column, test.row)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if rect != test.expected {
+				t.Errorf("tile covers %v, expected %v", rect, test.expected)
+			}
+			if tile.Rect.Dx() != int(rect.W) || tile.Rect.Dy() != int(rect.H) {
+				t.Errorf("tile is %v, expected the size of %v", tile.Rect, rect)
+			}
+		})
+	}
+
+	_, _, err = source.LoadTile(2, 0, 0)
+	if err == nil {
+		t.Errorf("expected an error for a missing tile")
+	}
+}
+
+func TestDeepZoomInvalidDescriptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		descriptor string
+	}{
+		{"not xml", "deepzoom"},
+		{"no size", `<Image TileSize="256" Overlap="0" Format="png"/>`},
+		{"no tile size", `<Image Overlap="0" Format="png"><Size Width="10" Height="10"/></Image>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.dzi")
+			err := os.WriteFile(filename, []byte(test.descriptor), 0644)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err = NewDeepZoomSource(filename)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package view
+
+import (
+	"fmt"
+	"math"
+)
+
+// DisplayMode replaces the colors of an image with one of its channels or a
+// false color view, after the conversion to display values
+type DisplayMode int
+
+const (
+	DisplayNormal DisplayMode = iota
+	DisplayRed
+	DisplayGreen
+	DisplayBlue
+	DisplayAlpha
+	DisplayLuminance
+	DisplayInverted
+	// DisplayZebra stripes clipped highlights red and clipped shadows blue
+	DisplayZebra
+
+	displayModeCount
+)
+
+var displayModeNames = map[DisplayMode]string{
+	DisplayNormal:    "normal",
+	DisplayRed:       "red",
+	DisplayGreen:     "green",
+	DisplayBlue:      "blue",
+	DisplayAlpha:     "alpha",
+	DisplayLuminance: "luminance",
+	DisplayInverted:  "inverted",
+	DisplayZebra:     "zebra",
+}
+
+// ZebraWidth is the width of the stripes of the zebra mode in window pixels
+const ZebraWidth = 8
+
+// zebra thresholds in display values, halfway the outermost 8-bit steps
+const (
+	zebraShadow    = 0.5 / 255
+	zebraHighlight = 254.5 / 255
+)
+
+func (d DisplayMode) String() string {
+	name, ok := displayModeNames[d]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(d))
+	}
+	return name
+}
+
+func (d DisplayMode) Next() DisplayMode {
+	return (d + 1) % displayModeCount
+}
+
+// Apply changes a display value drawn at the window position x, y, it
+// matches the image shader
+func (d DisplayMode) Apply(c [4]float64, x, y float64) [4]float64 {
+	switch d {
+	case DisplayRed, DisplayGreen, DisplayBlue, DisplayAlpha:
+		// channels are shown opaque, so hidden values show up as well
+		value := c[int(d-DisplayRed)]
+		return [4]float64{value, value, value, 1}
+	case DisplayLuminance:
+		value := 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+		return [4]float64{value, value, value, c[3]}
+	case DisplayInverted:
+		return [4]float64{1 - c[0], 1 - c[1], 1 - c[2], c[3]}
+	case DisplayZebra:
+		// pixel centers always add up to whole numbers, the half pixel keeps
+		// them off the stripe edges
+		if math.Mod(math.Floor((x+y+0.5)/ZebraWidth), 2) != 0 {
+			return c
+		}
+		if max(c[0], c[1], c[2]) >= zebraHighlight {
+			return [4]float64{1, 0, 0, c[3]}
+		}
+		if max(c[0], c[1], c[2]) <= zebraShadow {
+			return [4]float64{0, 0, 1, c[3]}
+		}
+	}
+	return c
+}
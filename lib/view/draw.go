@@ -1,7 +1,5 @@
 package view
 
-import gl "github.com/chsc/gogl/gl21"
-
 type Color struct {
 	R, G, B, A float64
 }
@@ -26,25 +24,18 @@ func (r *Rect) Y2() float64 {
 	return r.Y + r.H
 }
 
-func DrawQuad(rect Rect, color Color) {
-	gl.Color4f(gl.Float(color.R), gl.Float(color.G), gl.Float(color.B), gl.Float(color.A))
-
-	gl.Begin(gl.QUADS)
-	gl.Vertex3f(gl.Float(rect.X), gl.Float(rect.Y), 0)
-	gl.Vertex3f(gl.Float(rect.X2()), gl.Float(rect.Y), 0)
-	gl.Vertex3f(gl.Float(rect.X2()), gl.Float(rect.Y2()), 0)
-	gl.Vertex3f(gl.Float(rect.X), gl.Float(rect.Y2()), 0)
-	gl.End()
+func (r *Rect) Intersects(o Rect) bool {
+	return r.X < o.X2() && o.X < r.X2() && r.Y < o.Y2() && o.Y < r.Y2()
 }
 
-func DrawQuadOutline(rect Rect, width float64, color Color) {
-	DrawQuad(NewRect(rect.X, rect.Y, rect.W, width), color)
-	DrawQuad(NewRect(rect.X2()-width, rect.Y, width, rect.H), color)
-	DrawQuad(NewRect(rect.X, rect.Y2()-width, rect.W, width), color)
-	DrawQuad(NewRect(rect.X, rect.Y, width, rect.H), color)
+func DrawQuadOutline(r Renderer, rect Rect, width float64, color Color) {
+	r.DrawQuad(NewRect(rect.X, rect.Y, rect.W, width), color)
+	r.DrawQuad(NewRect(rect.X2()-width, rect.Y, width, rect.H), color)
+	r.DrawQuad(NewRect(rect.X, rect.Y2()-width, rect.W, width), color)
+	r.DrawQuad(NewRect(rect.X, rect.Y, width, rect.H), color)
 }
 
-func DrawQuadBorder(rect Rect, color Color, borderWidth float64, borderColor Color) {
-	DrawQuad(rect, color)
-	DrawQuadOutline(rect, borderWidth, borderColor)
+func DrawQuadBorder(r Renderer, rect Rect, color Color, borderWidth float64, borderColor Color) {
+	r.DrawQuad(rect, color)
+	DrawQuadOutline(r, rect, borderWidth, borderColor)
 }
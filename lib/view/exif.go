@@ -14,17 +14,43 @@ type Orientation struct {
 
 var DefaultOrientation = Orientation{false, 0}
 
+// orientationMap translates the exif orientation tag to the transformation
+// that displays the image upright: a horizontal mirror followed by clockwise
+// 90 degree rotations.
 var orientationMap = map[int]Orientation{
 	1: {false, 0},
 	2: {true, 0},
-	3: {true, 2},
-	4: {false, 2},
-	5: {true, 1},
+	3: {false, 2},
+	4: {true, 2},
+	5: {true, 3},
 	6: {false, 1},
-	7: {true, 3},
+	7: {true, 1},
 	8: {false, 3},
 }
 
+// Then returns the orientation applying o first and next second
+func (o Orientation) Then(next Orientation) Orientation {
+	rotations := o.numRotations
+	if next.mirrored {
+		// mirroring turns clockwise rotations counterclockwise
+		rotations = -rotations
+	}
+	return Orientation{
+		mirrored:     o.mirrored != next.mirrored,
+		numRotations: ((rotations+next.numRotations)%4 + 4) % 4,
+	}
+}
+
+// ExifValue returns the exif orientation tag value for o
+func (o Orientation) ExifValue() int {
+	for value, orientation := range orientationMap {
+		if orientation == o {
+			return value
+		}
+	}
+	return 1
+}
+
 func ReadExifOrientation(filename string) (Orientation, error) {
 	f, err := os.Open(filename)
 	if err != nil {
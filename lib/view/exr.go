@@ -0,0 +1,402 @@
+package view
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const exrMagic = 20000630
+
+// maxExrAttributeSize limits the attributes that are read, a channel list of
+// this size holds thousands of channels
+const maxExrAttributeSize = 1 << 16
+
+const (
+	exrVersionTiled     = 0x200
+	exrVersionMultipart = 0x1000
+	exrVersionDeep      = 0x800
+)
+
+const (
+	exrPixelUint  = 0
+	exrPixelHalf  = 1
+	exrPixelFloat = 2
+)
+
+const (
+	exrCompressionNone = 0
+	exrCompressionRLE  = 1
+	exrCompressionZIPS = 2
+	exrCompressionZIP  = 3
+)
+
+var exrLinesPerBlock = map[byte]int{
+	exrCompressionNone: 1,
+	exrCompressionRLE:  1,
+	exrCompressionZIPS: 1,
+	exrCompressionZIP:  16,
+}
+
+type exrChannel struct {
+	name      string
+	pixelType int32
+}
+
+func (c exrChannel) size() int {
+	if c.pixelType == exrPixelHalf {
+		return 2
+	}
+	return 4
+}
+
+// DecodeOpenEXR decodes single part scanline OpenEXR images. Only the
+// uncompressed, RLE and ZIP compression schemes are supported.
+func DecodeOpenEXR(input io.Reader) (*FloatImage, error) {
+	r := bufio.NewReader(input)
+
+	var magic, version int32
+	err := binary.Read(r, binary.LittleEndian, &magic)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading exr header: %s", err)
+	}
+	if magic != exrMagic {
+		return nil, fmt.Errorf("not an exr file")
+	}
+	err = binary.Read(r, binary.LittleEndian, &version)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading exr header: %s", err)
+	}
+	if version&(exrVersionTiled|exrVersionMultipart|exrVersionDeep) != 0 {
+		return nil, fmt.Errorf("tiled, deep and multipart exr files are not supported")
+	}
+
+	var channels []exrChannel
+	var compression byte
+	var minX, minY, maxX, maxY int32
+	hasDataWindow := false
+
+	for {
+		name, err := readNullTerminated(r)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr header: %s", err)
+		}
+		if len(name) == 0 {
+			break
+		}
+		attributeType, err := readNullTerminated(r)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr header: %s", err)
+		}
+		var size int32
+		err = binary.Read(r, binary.LittleEndian, &size)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr header: %s", err)
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("invalid exr attribute size")
+		}
+
+		// other attributes, like previews, may be large and are skipped
+		// without reading them into memory
+		if name != "channels" && name != "compression" && name != "dataWindow" {
+			_, err = io.CopyN(io.Discard, r, int64(size))
+			if err != nil {
+				return nil, fmt.Errorf("error while reading exr header: %s", err)
+			}
+			continue
+		}
+		if size > maxExrAttributeSize {
+			return nil, fmt.Errorf("exr attribute %s too large: %d bytes", name, size)
+		}
+		value := make([]byte, size)
+		_, err = io.ReadFull(r, value)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr header: %s", err)
+		}
+
+		switch {
+		case name == "channels" && attributeType == "chlist":
+			channels, err = parseExrChannels(value)
+			if err != nil {
+				return nil, err
+			}
+		case name == "compression" && len(value) == 1:
+			compression = value[0]
+		case name == "dataWindow" && len(value) == 16:
+			minX = int32(binary.LittleEndian.Uint32(value[0:]))
+			minY = int32(binary.LittleEndian.Uint32(value[4:]))
+			maxX = int32(binary.LittleEndian.Uint32(value[8:]))
+			maxY = int32(binary.LittleEndian.Uint32(value[12:]))
+			hasDataWindow = true
+		}
+	}
+
+	if !hasDataWindow || len(channels) == 0 {
+		return nil, fmt.Errorf("exr file is missing required attributes")
+	}
+	linesPerBlock, ok := exrLinesPerBlock[compression]
+	if !ok {
+		return nil, fmt.Errorf("unsupported exr compression: %d", compression)
+	}
+
+	// computed in int64, the difference of two int32 may overflow
+	w64 := int64(maxX) - int64(minX) + 1
+	h64 := int64(maxY) - int64(minY) + 1
+	if w64 > MaxFloatImageDimension || h64 > MaxFloatImageDimension {
+		return nil, fmt.Errorf("invalid exr data window: %dx%d exceeds the limit", w64, h64)
+	}
+	w, h := int(w64), int(h64)
+	err = checkFloatImageSize(w, h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exr data window: %s", err)
+	}
+
+	// the offset table is not needed when reading chunks sequentially
+	blockCount := (h + linesPerBlock - 1) / linesPerBlock
+	_, err = io.CopyN(io.Discard, r, int64(blockCount)*8)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading exr offsets: %s", err)
+	}
+
+	lineSize := 0
+	for _, c := range channels {
+		lineSize += c.size() * w
+	}
+
+	result := NewFloatImage(w, h, true)
+	hasAlpha := false
+	for _, c := range channels {
+		if c.name == "A" {
+			hasAlpha = true
+		}
+	}
+	if !hasAlpha {
+		for i := 3; i < len(result.Pix); i += 4 {
+			result.Pix[i] = 1
+		}
+	}
+
+	for block := 0; block < blockCount; block++ {
+		var y, size int32
+		err = binary.Read(r, binary.LittleEndian, &y)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr chunk: %s", err)
+		}
+		err = binary.Read(r, binary.LittleEndian, &size)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr chunk: %s", err)
+		}
+		// stored chunks are never larger than uncompressed ones
+		if size < 0 || int64(size) > int64(linesPerBlock)*int64(lineSize) {
+			return nil, fmt.Errorf("invalid exr chunk size")
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading exr chunk: %s", err)
+		}
+
+		firstLine := int(y - minY)
+		lines := min(linesPerBlock, h-firstLine)
+		if firstLine < 0 || lines <= 0 {
+			return nil, fmt.Errorf("exr chunk out of range")
+		}
+		expected := lines * lineSize
+
+		if len(data) < expected {
+			data, err = decompressExrBlock(compression, data, expected)
+			if err != nil {
+				return nil, fmt.Errorf("error while decompressing exr chunk: %s", err)
+			}
+		}
+		if len(data) != expected {
+			return nil, fmt.Errorf("unexpected exr chunk size")
+		}
+
+		readExrBlock(result, data, channels, firstLine, lines)
+	}
+
+	return result, nil
+}
+
+func readExrBlock(result *FloatImage, data []byte, channels []exrChannel, firstLine, lines int) {
+	offset := 0
+	for line := 0; line < lines; line++ {
+		y := firstLine + line
+		for _, c := range channels {
+			for x := 0; x < result.W; x++ {
+				var value float32
+				switch c.pixelType {
+				case exrPixelHalf:
+					value = halfToFloat(binary.LittleEndian.Uint16(data[offset:]))
+				case exrPixelFloat:
+					value = math.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
+				default:
+					value = float32(binary.LittleEndian.Uint32(data[offset:]))
+				}
+				offset += c.size()
+
+				o := result.offset(x, y)
+				switch c.name {
+				case "R":
+					result.Pix[o+0] = value
+				case "G":
+					result.Pix[o+1] = value
+				case "B":
+					result.Pix[o+2] = value
+				case "A":
+					result.Pix[o+3] = value
+				case "Y":
+					result.Pix[o+0] = value
+					result.Pix[o+1] = value
+					result.Pix[o+2] = value
+				}
+			}
+		}
+	}
+}
+
+func parseExrChannels(value []byte) ([]exrChannel, error) {
+	var channels []exrChannel
+	r := bytes.NewReader(value)
+	for {
+		name, err := readNullTerminated(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exr channel list: %s", err)
+		}
+		if len(name) == 0 {
+			break
+		}
+		// pixel type, pLinear and reserved bytes, x and y sampling
+		var fields struct {
+			PixelType int32
+			PLinear   [4]byte
+			XSampling int32
+			YSampling int32
+		}
+		err = binary.Read(r, binary.LittleEndian, &fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exr channel list: %s", err)
+		}
+		if fields.XSampling != 1 || fields.YSampling != 1 {
+			return nil, fmt.Errorf("subsampled exr channels are not supported")
+		}
+		channels = append(channels, exrChannel{name: name, pixelType: fields.PixelType})
+	}
+
+	// channels are stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].name < channels[j].name
+	})
+
+	return channels, nil
+}
+
+func decompressExrBlock(compression byte, data []byte, size int) ([]byte, error) {
+	var raw []byte
+
+	switch compression {
+	case exrCompressionRLE:
+		raw = make([]byte, 0, size)
+		for i := 0; i < len(data); {
+			count := int(int8(data[i]))
+			i++
+			if count < 0 {
+				if i-count > len(data) {
+					return nil, fmt.Errorf("rle literal run exceeds data")
+				}
+				raw = append(raw, data[i:i-count]...)
+				i -= count
+				continue
+			}
+			if i >= len(data) {
+				return nil, fmt.Errorf("rle run exceeds data")
+			}
+			for n := 0; n <= count; n++ {
+				raw = append(raw, data[i])
+			}
+			i++
+		}
+
+	case exrCompressionZIPS, exrCompressionZIP:
+		z, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		raw, err = io.ReadAll(z)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported compression: %d", compression)
+	}
+
+	if len(raw) != size {
+		return nil, fmt.Errorf("decompressed size mismatch")
+	}
+
+	// undo the delta predictor
+	for i := 1; i < len(raw); i++ {
+		raw[i] = byte(int(raw[i-1]) + int(raw[i]) - 128)
+	}
+
+	// the first half holds the even bytes, the second half the odd bytes
+	result := make([]byte, size)
+	half := (size + 1) / 2
+	for i := 0; i < size; i++ {
+		if i%2 == 0 {
+			result[i] = raw[i/2]
+		} else {
+			result[i] = raw[half+i/2]
+		}
+	}
+
+	return result, nil
+}
+
+func readNullTerminated(r io.Reader) (string, error) {
+	var result []byte
+	b := make([]byte, 1)
+	for {
+		_, err := io.ReadFull(r, b)
+		if err != nil {
+			return "", err
+		}
+		if b[0] == 0 {
+			return string(result), nil
+		}
+		result = append(result, b[0])
+		if len(result) > 255 {
+			return "", fmt.Errorf("string too long")
+		}
+	}
+}
+
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exponent := uint32(h>>10) & 0x1f
+	mantissa := uint32(h) & 0x3ff
+
+	switch {
+	case exponent == 0 && mantissa == 0:
+		return math.Float32frombits(sign)
+	case exponent == 0:
+		// subnormal
+		value := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+		return value
+	case exponent == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	}
+
+	return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+}
@@ -0,0 +1,286 @@
+package view
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func exrAttribute(name, attributeType string, value []byte) []byte {
+	data := append([]byte(name+"\x00"+attributeType+"\x00"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(data[len(data)-4:], uint32(len(value)))
+	return append(data, value...)
+}
+
+func exrChannelList(pixelType int32, names ...string) []byte {
+	var data []byte
+	for _, name := range names {
+		data = append(data, name+"\x00"...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(pixelType))
+		data = append(data, 0, 0, 0, 0)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+	}
+	return append(data, 0)
+}
+
+func exrHeader(channels []byte, compression byte, minX, minY, maxX, maxY int32) [][]byte {
+	var box []byte
+	for _, v := range []int32{minX, minY, maxX, maxY} {
+		box = binary.LittleEndian.AppendUint32(box, uint32(v))
+	}
+	return [][]byte{
+		exrAttribute("channels", "chlist", channels),
+		exrAttribute("compression", "compression", []byte{compression}),
+		exrAttribute("dataWindow", "box2i", box),
+		exrAttribute("owner", "string", []byte("test")),
+	}
+}
+
+func exrChunk(y int32, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32(nil, uint32(y))
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(data)))
+	return append(chunk, data...)
+}
+
+// buildEXR returns a single part scanline exr with an empty offset table
+func buildEXR(attributes [][]byte, chunks ...[]byte) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, exrMagic)
+	data = binary.LittleEndian.AppendUint32(data, 2)
+	for _, attribute := range attributes {
+		data = append(data, attribute...)
+	}
+	data = append(data, 0)
+	data = append(data, make([]byte, 8*len(chunks))...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// exrPredict splits a block in even and odd bytes and delta encodes it, the
+// way the RLE and ZIP compressors do before compressing
+func exrPredict(data []byte) []byte {
+	half := (len(data) + 1) / 2
+	split := make([]byte, len(data))
+	for i, b := range data {
+		if i%2 == 0 {
+			split[i/2] = b
+		} else {
+			split[half+i/2] = b
+		}
+	}
+
+	result := make([]byte, len(split))
+	result[0] = split[0]
+	for i := 1; i < len(split); i++ {
+		result[i] = byte(int(split[i]) - int(split[i-1]) + 128)
+	}
+	return result
+}
+
+func exrRLE(data []byte) []byte {
+	data = exrPredict(data)
+	var result []byte
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+		if run >= 3 {
+			result = append(result, byte(run-1), data[i])
+			i += run
+			continue
+		}
+
+		// literal bytes up to the next run
+		start := i
+		for i < len(data) && i-start < 127 && !(i+2 < len(data) && data[i] == data[i+1] && data[i] == data[i+2]) {
+			i++
+		}
+		result = append(result, byte(-int8(i-start)))
+		result = append(result, data[start:i]...)
+	}
+	return result
+}
+
+func exrZIP(data []byte) []byte {
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	_, _ = z.Write(exrPredict(data))
+	_ = z.Close()
+	return compressed.Bytes()
+}
+
+// testEXRLines returns the lines of a 16x2 image with half B, G and R
+// channels, all 0.5 apart from G at 0, 0 being 1 and R at 3, 1 being 2
+func testEXRLines() [][]byte {
+	const (
+		half     = 0x3800
+		one      = 0x3c00
+		two      = 0x4000
+		testEXRW = 16
+	)
+	var lines [][]byte
+	for y := 0; y < 2; y++ {
+		var line []byte
+		for _, channel := range "BGR" {
+			for x := 0; x < testEXRW; x++ {
+				value := uint16(half)
+				switch {
+				case channel == 'G' && x == 0 && y == 0:
+					value = one
+				case channel == 'R' && x == 3 && y == 1:
+					value = two
+				}
+				line = binary.LittleEndian.AppendUint16(line, value)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestDecodeOpenEXR(t *testing.T) {
+	lines := testEXRLines()
+	channels := exrChannelList(exrPixelHalf, "R", "G", "B")
+	block := append(append([]byte{}, lines[0]...), lines[1]...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			"uncompressed",
+			buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 1), exrChunk(0, lines[0]), exrChunk(1, lines[1])),
+		},
+		{
+			"rle",
+			buildEXR(exrHeader(channels, exrCompressionRLE, 0, 0, 15, 1), exrChunk(0, exrRLE(lines[0])), exrChunk(1, exrRLE(lines[1]))),
+		},
+		{
+			"zip single lines",
+			buildEXR(exrHeader(channels, exrCompressionZIPS, 0, 0, 15, 1), exrChunk(0, exrZIP(lines[0])), exrChunk(1, exrZIP(lines[1]))),
+		},
+		{
+			"zip blocks",
+			buildEXR(exrHeader(channels, exrCompressionZIP, 0, 0, 15, 1), exrChunk(0, exrZIP(block))),
+		},
+		{
+			"offset data window",
+			buildEXR(exrHeader(channels, exrCompressionZIP, -4, 10, 11, 11), exrChunk(10, exrZIP(block))),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i, err := DecodeOpenEXR(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if i.W != 16 || i.H != 2 || !i.Linear {
+				t.Fatalf("image is %dx%d, linear %t, expected 16x2 linear", i.W, i.H, i.Linear)
+			}
+
+			checks := []struct {
+				x, y     int
+				expected [4]float32
+			}{
+				{0, 0, [4]float32{0.5, 1, 0.5, 1}},
+				{1, 0, [4]float32{0.5, 0.5, 0.5, 1}},
+				{3, 1, [4]float32{2, 0.5, 0.5, 1}},
+				{15, 1, [4]float32{0.5, 0.5, 0.5, 1}},
+			}
+			for _, check := range checks {
+				var pixel [4]float32
+				copy(pixel[:], i.Pix[i.offset(check.x, check.y):])
+				if pixel != check.expected {
+					t.Errorf("pixel %d, %d is %v, expected %v", check.x, check.y, pixel, check.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeOpenEXRLuminance(t *testing.T) {
+	var line []byte
+	for _, value := range []float32{0.25, 4} {
+		line = binary.LittleEndian.AppendUint32(line, math.Float32bits(value))
+	}
+	data := buildEXR(exrHeader(exrChannelList(exrPixelFloat, "Y"), exrCompressionNone, 0, 0, 1, 0), exrChunk(0, line))
+
+	i, err := DecodeOpenEXR(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []float32{0.25, 0.25, 0.25, 1, 4, 4, 4, 1}
+	for n := range expected {
+		if i.Pix[n] != expected[n] {
+			t.Fatalf("pixels are %v, expected %v", i.Pix, expected)
+		}
+	}
+}
+
+func TestDecodeOpenEXRInvalid(t *testing.T) {
+	channels := exrChannelList(exrPixelHalf, "R", "G", "B")
+	line := testEXRLines()[0]
+
+	// x sampling of 2
+	subsampled := exrChannelList(exrPixelHalf, "R")
+	subsampled[10] = 2
+
+	tiled := buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 0), exrChunk(0, line))
+	tiled[5] |= exrVersionTiled >> 8
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not exr", []byte("#?RADIANCE\n")},
+		{"tiled", tiled},
+		{"missing data window", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 0)[:2])},
+		{"piz compression", buildEXR(exrHeader(channels, 4, 0, 0, 15, 0), exrChunk(0, line))},
+		{"subsampled channel", buildEXR(exrHeader(subsampled, exrCompressionNone, 0, 0, 15, 0))},
+		{"channel list too large", buildEXR([][]byte{exrAttribute("channels", "chlist", make([]byte, maxExrAttributeSize+1))})},
+		{"data window too wide", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, MaxFloatImageDimension, 0))},
+		{"data window overflow", buildEXR(exrHeader(channels, exrCompressionNone, -1<<31, 0, 1<<31-1, 0))},
+		{"inverted data window", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, -2, 0))},
+		{"too many pixels", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, MaxFloatImageDimension-1, MaxFloatImageDimension-1))},
+		{"chunk larger than block", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 0), exrChunk(0, make([]byte, len(line)+1)))},
+		{"chunk out of range", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 0), exrChunk(1, line))},
+		{"truncated chunk", buildEXR(exrHeader(channels, exrCompressionNone, 0, 0, 15, 0), exrChunk(0, line)[:20])},
+		{"rle run exceeds data", buildEXR(exrHeader(channels, exrCompressionRLE, 0, 0, 15, 0), exrChunk(0, []byte{0x80, 1, 2}))},
+		{"rle size mismatch", buildEXR(exrHeader(channels, exrCompressionRLE, 0, 0, 15, 0), exrChunk(0, []byte{4, 1}))},
+		{"corrupt zip", buildEXR(exrHeader(channels, exrCompressionZIPS, 0, 0, 15, 0), exrChunk(0, []byte{1, 2, 3}))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeOpenEXR(bytes.NewReader(test.data))
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	tests := []struct {
+		half     uint16
+		expected float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.333251953125},
+		{0x0001, 1.0 / (1 << 24)},
+		{0x7bff, 65504},
+	}
+	for _, test := range tests {
+		if value := halfToFloat(test.half); value != test.expected {
+			t.Errorf("half %#04x is %g, expected %g", test.half, value, test.expected)
+		}
+	}
+}
@@ -9,9 +9,15 @@ import (
 
 var supportedFileExtensions = map[string]bool{
 	".bmp":  true,
+	".dzi":  true,
+	".exr":  true,
+	".hdr":  true,
 	".jpg":  true,
 	".jpeg": true,
 	".png":  true,
+	".tif":  true,
+	".tiff": true,
+	".webp": true,
 }
 
 type FileCursor struct {
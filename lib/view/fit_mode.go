@@ -0,0 +1,96 @@
+package view
+
+import (
+	"fmt"
+	"math"
+)
+
+// FitMode determines the scale at which an image is shown when it is loaded
+type FitMode int
+
+const (
+	// FitShrink shrinks images larger than the window, smaller images are
+	// shown at their original size
+	FitShrink FitMode = iota
+	// FitAlways shrinks or enlarges images to fit the window
+	FitAlways
+	// FitWidth scales images to the width of the window
+	FitWidth
+	// FitHeight scales images to the height of the window
+	FitHeight
+	// FitFill scales images to cover the whole window
+	FitFill
+	// FitOriginal shows images at their original size
+	FitOriginal
+
+	fitModeCount
+)
+
+var fitModeNames = map[FitMode]string{
+	FitShrink:   "fit (shrink)",
+	FitAlways:   "fit",
+	FitWidth:    "fit width",
+	FitHeight:   "fit height",
+	FitFill:     "fill",
+	FitOriginal: "original size",
+}
+
+func (f FitMode) String() string {
+	name, ok := fitModeNames[f]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(f))
+	}
+	return name
+}
+
+func (f FitMode) Next() FitMode {
+	return (f + 1) % fitModeCount
+}
+
+// Scale returns the scale at which an image of w by h is shown in a window of
+// windowW by windowH
+func (f FitMode) Scale(w, h, windowW, windowH float64) float64 {
+	scaleW := windowW / w
+	scaleH := windowH / h
+
+	switch f {
+	case FitShrink:
+		return math.Min(1, math.Min(scaleW, scaleH))
+	case FitAlways:
+		return math.Min(scaleW, scaleH)
+	case FitWidth:
+		return scaleW
+	case FitHeight:
+		return scaleH
+	case FitFill:
+		return math.Max(scaleW, scaleH)
+	default:
+		return 1
+	}
+}
+
+// Fit centers the image and scales it according to mode. Images that are
+// fitted to the width or height and overflow the window are aligned to the
+// top or left, which is where reading starts.
+func (m *Main) Fit(mode FitMode) {
+	m.StopViewAnimations()
+
+	m.View.X = m.View.W / 2
+	m.View.Y = m.View.H / 2
+
+	if m.Texture == nil {
+		return
+	}
+
+	w, h := m.View.RotatedSize(m.Texture.W, m.Texture.H)
+	m.View.Scale = mode.Scale(w, h, m.View.W, m.View.H)
+
+	if mode == FitWidth && h*m.View.Scale > m.View.H {
+		m.View.Y = h * m.View.Scale / 2
+	}
+	if mode == FitHeight && w*m.View.Scale > m.View.W {
+		m.View.X = w * m.View.Scale / 2
+	}
+
+	m.ConstrainView()
+}
@@ -0,0 +1,193 @@
+package view
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FloatImage holds RGBA pixels as 32-bit floats, for sources that do not fit
+// in 8 bits per channel. Linear is set when the values are scene-referred
+// linear light (HDR formats) rather than sRGB encoded.
+type FloatImage struct {
+	W, H   int
+	Pix    []float32
+	Linear bool
+}
+
+// Limits for the size of a FloatImage decoded from a file header, so a
+// malformed file can not make the viewer allocate more than 4 GiB
+const (
+	MaxFloatImageDimension = 1 << 16
+	MaxFloatImagePixels    = 1 << 28
+)
+
+// checkFloatImageSize returns an error when a w by h FloatImage is empty or
+// exceeds the limits
+func checkFloatImageSize(w, h int) error {
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid image size %dx%d", w, h)
+	}
+	if w > MaxFloatImageDimension || h > MaxFloatImageDimension || w > MaxFloatImagePixels/h {
+		return fmt.Errorf("image size %dx%d exceeds the limit", w, h)
+	}
+	return nil
+}
+
+func NewFloatImage(w, h int, linear bool) *FloatImage {
+	return &FloatImage{
+		W:      w,
+		H:      h,
+		Pix:    make([]float32, w*h*4),
+		Linear: linear,
+	}
+}
+
+func (i *FloatImage) offset(x, y int) int {
+	return (y*i.W + x) * 4
+}
+
+func (i *FloatImage) Set(x, y int, r, g, b, a float32) {
+	o := i.offset(x, y)
+	i.Pix[o+0] = r
+	i.Pix[o+1] = g
+	i.Pix[o+2] = b
+	i.Pix[o+3] = a
+}
+
+func (i *FloatImage) ColorModel() color.Model {
+	return color.NRGBA64Model
+}
+
+func (i *FloatImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, i.W, i.H)
+}
+
+// At clamps the pixel to 16 bits per channel, renderers read Pix directly to
+// keep the full range.
+func (i *FloatImage) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(i.Bounds()) {
+		return color.NRGBA64{}
+	}
+	o := i.offset(x, y)
+	channel := func(v float32) uint16 {
+		return uint16(min(max(v, 0), 1)*0xffff + 0.5)
+	}
+	return color.NRGBA64{
+		R: channel(i.Pix[o+0]),
+		G: channel(i.Pix[o+1]),
+		B: channel(i.Pix[o+2]),
+		A: channel(i.Pix[o+3]),
+	}
+}
+
+// Orient applies an exif orientation the same way NewTextureFromFile does for
+// SDL surfaces: first a horizontal mirror, then clockwise 90 degree rotations.
+func (i *FloatImage) Orient(orientation Orientation) *FloatImage {
+	result := i
+	if orientation.mirrored {
+		result = result.mirror()
+	}
+	for n := 0; n < orientation.numRotations%4; n++ {
+		result = result.rotateClockwise()
+	}
+	return result
+}
+
+func (i *FloatImage) mirror() *FloatImage {
+	result := NewFloatImage(i.W, i.H, i.Linear)
+	for y := 0; y < i.H; y++ {
+		for x := 0; x < i.W; x++ {
+			copy(result.Pix[result.offset(i.W-1-x, y):][:4], i.Pix[i.offset(x, y):][:4])
+		}
+	}
+	return result
+}
+
+func (i *FloatImage) rotateClockwise() *FloatImage {
+	result := NewFloatImage(i.H, i.W, i.Linear)
+	for y := 0; y < i.H; y++ {
+		for x := 0; x < i.W; x++ {
+			copy(result.Pix[result.offset(i.H-1-y, x):][:4], i.Pix[i.offset(x, y):][:4])
+		}
+	}
+	return result
+}
+
+func NewFloatImageFromImage(src image.Image) *FloatImage {
+	bounds := src.Bounds()
+	result := NewFloatImage(bounds.Dx(), bounds.Dy(), false)
+	for y := 0; y < result.H; y++ {
+		for x := 0; x < result.W; x++ {
+			r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			if a == 0 {
+				result.Set(x, y, 0, 0, 0, 0)
+				continue
+			}
+			// RGBA() is alpha premultiplied, the texture is not
+			fa := float32(a)
+			result.Set(x, y, float32(r)/fa, float32(g)/fa, float32(b)/fa, fa/0xffff)
+		}
+	}
+	return result
+}
+
+// IsHighBitDepthFile reports whether a file has to be loaded as a FloatImage
+// instead of through SDL_image, which only produces 8-bit surfaces.
+func IsHighBitDepthFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hdr", ".exr":
+		return true
+	case ".png":
+		depth, err := pngBitDepth(filename)
+		return err == nil && depth == 16
+	}
+	return false
+}
+
+func LoadFloatImage(filename string) (*FloatImage, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening file: %s", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hdr":
+		return DecodeRadiance(f)
+	case ".exr":
+		return DecodeOpenEXR(f)
+	case ".png":
+		i, err := png.Decode(f)
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding png: %s", err)
+		}
+		return NewFloatImageFromImage(i), nil
+	}
+
+	return nil, fmt.Errorf("unsupported high bit depth file: %s", filename)
+}
+
+func pngBitDepth(filename string) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// 8 byte signature, IHDR length and type, width and height, bit depth
+	header := make([]byte, 25)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return 0, err
+	}
+	if string(header[12:16]) != "IHDR" {
+		return 0, fmt.Errorf("missing IHDR chunk")
+	}
+	return int(header[24]), nil
+}
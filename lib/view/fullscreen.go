@@ -0,0 +1,95 @@
+package view
+
+import (
+	"log"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// SetFullscreen switches between the window and desktop fullscreen. The
+// geometry of the window is stored before going fullscreen and restored when
+// leaving it.
+func (m *Main) SetFullscreen(fullscreen bool) {
+	if fullscreen == m.Fullscreen {
+		return
+	}
+
+	if fullscreen {
+		m.storeWindowGeometry()
+		err := m.Window.SetFullscreen(sdl.WINDOW_FULLSCREEN_DESKTOP)
+		if err != nil {
+			log.Printf("failed to switch to fullscreen: %s", err)
+			return
+		}
+	} else {
+		err := m.Window.SetFullscreen(0)
+		if err != nil {
+			log.Printf("failed to leave fullscreen: %s", err)
+			return
+		}
+		m.Window.SetSize(int32(m.Settings.Window.W), int32(m.Settings.Window.H))
+		m.Window.SetPosition(int32(m.Settings.Window.X), int32(m.Settings.Window.Y))
+	}
+	m.Fullscreen = fullscreen
+
+	w, h := m.Window.GetSize()
+	m.ResetView(float64(w), float64(h))
+	m.Fit(m.Settings.FitMode)
+
+	m.ShowCursor()
+}
+
+// storeWindowGeometry remembers the position and size of the window, unless
+// it is fullscreen
+func (m *Main) storeWindowGeometry() {
+	if m.Fullscreen {
+		return
+	}
+
+	x, y := m.Window.GetPosition()
+	w, h := m.Window.GetSize()
+	m.Settings.Window.X = uint32(x)
+	m.Settings.Window.Y = uint32(y)
+	m.Settings.Window.W = uint32(w)
+	m.Settings.Window.H = uint32(h)
+}
+
+// ShowCursor shows the mouse cursor after it moved, while fullscreen it is
+// hidden again after HideCursorDelay seconds without movement.
+func (m *Main) ShowCursor() {
+	m.lastCursorActivity = time.Now()
+	if m.cursorHidden {
+		_, _ = sdl.ShowCursor(sdl.ENABLE)
+		m.cursorHidden = false
+	}
+
+	if !m.Fullscreen || m.Settings.HideCursorDelay <= 0 {
+		return
+	}
+
+	delay := time.Duration(m.Settings.HideCursorDelay * float64(time.Second))
+	if m.hideCursorTimer == nil {
+		m.hideCursorTimer = time.AfterFunc(delay, func() {
+			m.PostCommand(HideCursorCommand{})
+		})
+	} else {
+		m.hideCursorTimer.Reset(delay)
+	}
+}
+
+// HideCursor hides the mouse cursor when it has not moved for the configured
+// delay and the window is fullscreen.
+func (m *Main) HideCursor() {
+	delay := time.Duration(m.Settings.HideCursorDelay * float64(time.Second))
+	if !m.Fullscreen || m.cursorHidden || delay <= 0 || time.Since(m.lastCursorActivity) < delay {
+		// the timer may fire just after the cursor moved again
+		return
+	}
+	if m.Mouse.DragLeft.Dragging || m.Mouse.DragRight.Dragging || m.Mouse.Navigating {
+		return
+	}
+
+	_, _ = sdl.ShowCursor(sdl.DISABLE)
+	m.cursorHidden = true
+}
@@ -0,0 +1,501 @@
+package view
+
+import (
+	"fmt"
+	"image"
+
+	gl "github.com/chsc/gogl/gl33"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// vertices are stored as x, y, u, v
+const (
+	vertexComponents = 4
+	vertexStride     = vertexComponents * 4
+	quadVertices     = 4
+)
+
+// GLRenderer draws quads with a core profile compatible pipeline: a single
+// streamed vertex buffer and shader programs sharing an orthographic
+// projection in window coordinates.
+type GLRenderer struct {
+	QuadShader  *ShaderProgram
+	ImageShader *ShaderProgram
+	TextShader  *ShaderProgram
+
+	window *sdl.Window
+
+	vao, vbo   gl.Uint
+	projection [16]gl.Float
+	transform  Transform
+	clip       Clip
+
+	// samplers hold the filters of each sampling mode, so images do not need
+	// their own texture parameters changed when the mode changes
+	samplers [samplingCount]gl.Uint
+
+	conversion    colorConversion
+	sourceCurves  gl.Uint
+	displayCurves gl.Uint
+
+	font gl.Uint
+
+	// readFramebuffer has an image attached to read back its pixels
+	readFramebuffer gl.Uint
+
+	maxImageSize int
+}
+
+type glImage struct {
+	id   gl.Uint
+	w, h int
+}
+
+func (i *glImage) Destroy() {
+	gl.DeleteTextures(1, &i.id)
+}
+
+// NewGLRenderer sets up drawing to the window, its GL context has to be
+// current.
+func NewGLRenderer(window *sdl.Window) (*GLRenderer, error) {
+	err := gl.Init()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize opengl")
+	}
+
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+
+	quadShader, err := NewShaderProgram(vertexShader, quadFragmentShader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quad shader: %s", err)
+	}
+
+	imageShader, err := NewShaderProgram(vertexShader, imageFragmentShader)
+	if err != nil {
+		quadShader.Destroy()
+		return nil, fmt.Errorf("failed to create image shader: %s", err)
+	}
+
+	textShader, err := NewShaderProgram(vertexShader, textFragmentShader)
+	if err != nil {
+		quadShader.Destroy()
+		imageShader.Destroy()
+		return nil, fmt.Errorf("failed to create text shader: %s", err)
+	}
+
+	r := &GLRenderer{
+		QuadShader:  quadShader,
+		ImageShader: imageShader,
+		TextShader:  textShader,
+		window:      window,
+		transform:   IdentityTransform,
+	}
+
+	gl.GenVertexArrays(1, &r.vao)
+	gl.BindVertexArray(r.vao)
+
+	gl.GenBuffers(1, &r.vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.Sizeiptr(quadVertices*vertexStride), nil, gl.STREAM_DRAW)
+
+	gl.EnableVertexAttribArray(0)
+	gl.VertexAttribPointer(0, 2, gl.FLOAT, gl.FALSE, vertexStride, gl.Offset(nil, 0))
+	gl.EnableVertexAttribArray(1)
+	gl.VertexAttribPointer(1, 2, gl.FLOAT, gl.FALSE, vertexStride, gl.Offset(nil, 2*4))
+
+	filters := [samplingCount][2]gl.Int{
+		SamplingLinear:           {gl.LINEAR_MIPMAP_LINEAR, gl.LINEAR},
+		SamplingNearestMagnified: {gl.LINEAR_MIPMAP_LINEAR, gl.NEAREST},
+		SamplingNearest:          {gl.NEAREST_MIPMAP_NEAREST, gl.NEAREST},
+	}
+	gl.GenSamplers(gl.Sizei(samplingCount), &r.samplers[0])
+	for i, filter := range filters {
+		gl.SamplerParameteri(r.samplers[i], gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.SamplerParameteri(r.samplers[i], gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		gl.SamplerParameteri(r.samplers[i], gl.TEXTURE_MIN_FILTER, filter[0])
+		gl.SamplerParameteri(r.samplers[i], gl.TEXTURE_MAG_FILTER, filter[1])
+	}
+
+	r.font = newFontTexture()
+	gl.GenFramebuffers(1, &r.readFramebuffer)
+
+	var maxTextureSize gl.Int
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &maxTextureSize)
+	r.maxImageSize = int(maxTextureSize)
+
+	return r, nil
+}
+
+// newFontTexture uploads the glyphs of the built-in font next to each other
+// in a single row.
+func newFontTexture() gl.Uint {
+	w := len(fontGlyphs) * fontGlyphW
+	data := make([]byte, w*fontGlyphH)
+	for index := range fontGlyphs {
+		for y := 0; y < fontGlyphH; y++ {
+			for x := 0; x < fontGlyphW; x++ {
+				if fontPixel(index, x, y) {
+					data[y*w+index*fontGlyphW+x] = 0xff
+				}
+			}
+		}
+	}
+
+	var id gl.Uint
+	gl.GenTextures(1, &id)
+	gl.BindTexture(gl.TEXTURE_2D, id)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.Int(gl.R8), gl.Sizei(w), fontGlyphH, 0, gl.RED, gl.UNSIGNED_BYTE, gl.Pointer(&data[0]))
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	return id
+}
+
+func newCurveTexture(size int, table []float32) gl.Uint {
+	var id gl.Uint
+	gl.GenTextures(1, &id)
+	gl.BindTexture(gl.TEXTURE_1D, id)
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexImage1D(gl.TEXTURE_1D, 0, gl.Int(gl.RGB16F), gl.Sizei(size), 0, gl.RGB, gl.FLOAT, gl.Pointer(&table[0]))
+	gl.BindTexture(gl.TEXTURE_1D, 0)
+
+	return id
+}
+
+// SetViewport maps window coordinates to the viewport, with the origin in the
+// top left corner.
+func (r *GLRenderer) SetViewport(w, h float64) {
+	gl.Viewport(0, 0, gl.Sizei(w), gl.Sizei(h))
+
+	r.projection = [16]gl.Float{
+		gl.Float(2 / w), 0, 0, 0,
+		0, gl.Float(-2 / h), 0, 0,
+		0, 0, -1, 0,
+		-1, 1, 0, 1,
+	}
+}
+
+func (r *GLRenderer) MaxImageSize() int {
+	return r.maxImageSize
+}
+
+// NewImage uploads pixels to a texture. Mipmaps are generated after the
+// upload, so minified images are sampled without aliasing.
+func (r *GLRenderer) NewImage(pixels image.Image, rect image.Rectangle) RendererImage {
+	i := &glImage{w: rect.Dx(), h: rect.Dy()}
+	gl.GenTextures(1, &i.id)
+	gl.BindTexture(gl.TEXTURE_2D, i.id)
+
+	w, h := gl.Sizei(rect.Dx()), gl.Sizei(rect.Dy())
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+
+	switch p := pixels.(type) {
+	case *FloatImage:
+		gl.PixelStorei(gl.UNPACK_ROW_LENGTH, gl.Int(p.W))
+		gl.PixelStorei(gl.UNPACK_SKIP_PIXELS, gl.Int(rect.Min.X))
+		gl.PixelStorei(gl.UNPACK_SKIP_ROWS, gl.Int(rect.Min.Y))
+		// half floats would truncate 16 bit sources to 11 bits, values in
+		// 0..1 fit a 16 bit normalized format and linear light needs floats
+		format := gl.Int(gl.RGBA16)
+		if p.Linear {
+			format = gl.RGBA32F
+		}
+		gl.TexImage2D(gl.TEXTURE_2D, 0, format, w, h, 0, gl.RGBA, gl.FLOAT, gl.Pointer(&p.Pix[0]))
+	default:
+		nrgba, ok := p.(*image.NRGBA)
+		if !ok {
+			nrgba = convertImage(p, rect)
+		}
+		gl.PixelStorei(gl.UNPACK_ROW_LENGTH, gl.Int(nrgba.Stride/4))
+		gl.PixelStorei(gl.UNPACK_SKIP_PIXELS, gl.Int(rect.Min.X-nrgba.Rect.Min.X))
+		gl.PixelStorei(gl.UNPACK_SKIP_ROWS, gl.Int(rect.Min.Y-nrgba.Rect.Min.Y))
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, w, h, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Pointer(&nrgba.Pix[0]))
+	}
+
+	gl.PixelStorei(gl.UNPACK_ROW_LENGTH, 0)
+	gl.PixelStorei(gl.UNPACK_SKIP_PIXELS, 0)
+	gl.PixelStorei(gl.UNPACK_SKIP_ROWS, 0)
+
+	gl.GenerateMipmap(gl.TEXTURE_2D)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	return i
+}
+
+// ReadPixel attaches the image to a framebuffer and reads the pixel from it,
+// the rows of images are uploaded top first so y needs no flipping.
+func (r *GLRenderer) ReadPixel(ri RendererImage, x, y int) [4]float64 {
+	i := ri.(*glImage)
+	var previous gl.Int
+	gl.GetIntegerv(gl.READ_FRAMEBUFFER_BINDING, &previous)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.readFramebuffer)
+	gl.FramebufferTexture2D(gl.READ_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, i.id, 0)
+
+	var p [4]gl.Float
+	gl.ReadPixels(gl.Int(x), gl.Int(y), 1, 1, gl.RGBA, gl.FLOAT, gl.Pointer(&p[0]))
+
+	gl.FramebufferTexture2D(gl.READ_FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, 0, 0)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, gl.Uint(previous))
+	return [4]float64{float64(p[0]), float64(p[1]), float64(p[2]), float64(p[3])}
+}
+
+func (r *GLRenderer) Clear(color Color) {
+	gl.ClearColor(gl.Float(color.R), gl.Float(color.G), gl.Float(color.B), gl.Float(color.A))
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+}
+
+// SetTransform applies the transformation to the vertices of the following
+// quads, the projection stays the same.
+func (r *GLRenderer) SetTransform(t Transform) {
+	r.transform = t
+}
+
+// SetClip makes the fragment shaders discard the fragments outside of clip
+func (r *GLRenderer) SetClip(clip Clip) {
+	r.clip = clip
+}
+
+func (r *GLRenderer) drawQuad(p *ShaderProgram, rect Rect, texCoords Rect) {
+	p.Use()
+	gl.UniformMatrix4fv(p.Uniform("projection"), 1, gl.FALSE, &r.projection[0])
+	p.SetInt("clipShape", int(r.clip.Shape))
+	gl.Uniform4f(p.Uniform("clipRect"), gl.Float(r.clip.Rect.X), gl.Float(r.clip.Rect.Y), gl.Float(r.clip.Rect.W), gl.Float(r.clip.Rect.H))
+
+	corners := r.transform.Corners(rect)
+	vertices := [quadVertices * vertexComponents]gl.Float{
+		gl.Float(corners[0][0]), gl.Float(corners[0][1]), gl.Float(texCoords.X), gl.Float(texCoords.Y),
+		gl.Float(corners[1][0]), gl.Float(corners[1][1]), gl.Float(texCoords.X2()), gl.Float(texCoords.Y),
+		gl.Float(corners[2][0]), gl.Float(corners[2][1]), gl.Float(texCoords.X), gl.Float(texCoords.Y2()),
+		gl.Float(corners[3][0]), gl.Float(corners[3][1]), gl.Float(texCoords.X2()), gl.Float(texCoords.Y2()),
+	}
+
+	gl.BindVertexArray(r.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, gl.Sizeiptr(len(vertices)*4), gl.Pointer(&vertices[0]))
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, quadVertices)
+}
+
+func (r *GLRenderer) DrawQuad(rect Rect, color Color) {
+	r.QuadShader.Use()
+	setColorUniform(r.QuadShader, color)
+	r.QuadShader.SetFloat("checkerboardSize", 0)
+	r.drawQuad(r.QuadShader, rect, NewRect(0, 0, 0, 0))
+}
+
+// DrawCheckerboard passes the position relative to the first light square
+// as texture coordinates, the quad shader picks the color of the square.
+func (r *GLRenderer) DrawCheckerboard(rect Rect, x, y, size float64, light, dark Color) {
+	p := r.QuadShader
+	p.Use()
+	setColorUniform(p, light)
+	gl.Uniform4f(p.Uniform("darkColor"), gl.Float(dark.R), gl.Float(dark.G), gl.Float(dark.B), gl.Float(dark.A))
+	p.SetFloat("checkerboardSize", size)
+	r.drawQuad(p, rect, NewRect(rect.X-x, rect.Y-y, rect.W, rect.H))
+}
+
+func (r *GLRenderer) DrawImage(ri RendererImage, source, rect Rect, options ImageOptions) {
+	i := ri.(*glImage)
+
+	p := r.ImageShader
+	p.Use()
+	p.SetInt("imageTexture", 0)
+	p.SetInt("isLinear", boolToInt(options.Linear))
+	p.SetFloat("exposure", options.ToneMapping.Exposure)
+	p.SetInt("toneMapOperator", int(options.ToneMapping.Operator))
+	p.SetInt("displayMode", int(options.DisplayMode))
+	p.SetFloat("zebraWidth", ZebraWidth)
+
+	a := options.Adjustments
+	p.SetFloat("brightness", a.Shown(AdjustBrightness))
+	p.SetFloat("contrast", a.Shown(AdjustContrast))
+	p.SetFloat("gamma", a.Shown(AdjustGamma))
+	p.SetFloat("saturation", a.Shown(AdjustSaturation))
+	p.SetFloat("blackPoint", a.Shown(AdjustBlackPoint))
+	p.SetFloat("whitePoint", a.Shown(AdjustWhitePoint))
+
+	p.SetInt("colorManaged", boolToInt(options.ColorManagement.Enabled))
+	if options.ColorManagement.Enabled {
+		r.setColorConversion(p, options.Profile, options.ColorManagement.Display)
+	}
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, i.id)
+	gl.BindSampler(0, r.samplers[options.Sampling])
+	w, h := float64(i.w), float64(i.h)
+	r.drawQuad(p, rect, NewRect(source.X/w, source.Y/h, source.W/w, source.H/h))
+	gl.BindSampler(0, 0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// setColorConversion binds the lookup textures converting source to display
+// to texture units 1 and 2, they are only uploaded again when a profile
+// changed.
+func (r *GLRenderer) setColorConversion(p *ShaderProgram, source, display *ColorProfile) {
+	if display == nil {
+		display = SRGBProfile
+	}
+	if r.conversion.update(source, display) {
+		gl.DeleteTextures(1, &r.sourceCurves)
+		gl.DeleteTextures(1, &r.displayCurves)
+		r.sourceCurves = newCurveTexture(sourceCurveSize, r.conversion.sourceCurves)
+		r.displayCurves = newCurveTexture(displayCurveSize, r.conversion.displayCurves)
+	}
+
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_1D, r.sourceCurves)
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_1D, r.displayCurves)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	var matrix [9]gl.Float
+	for i, value := range r.conversion.matrix {
+		matrix[i] = gl.Float(value)
+	}
+
+	p.SetInt("sourceCurves", 1)
+	p.SetInt("displayCurves", 2)
+	p.SetFloat("sourceCurveSize", sourceCurveSize)
+	p.SetFloat("displayCurveSize", displayCurveSize)
+	gl.UniformMatrix3fv(p.Uniform("colorMatrix"), 1, gl.TRUE, &matrix[0])
+}
+
+func (r *GLRenderer) DrawText(text string, x, y float64, color Color) {
+	r.TextShader.Use()
+	setColorUniform(r.TextShader, color)
+	r.TextShader.SetInt("fontTexture", 0)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, r.font)
+
+	glyphW := 1 / float64(len(fontGlyphs))
+	for _, c := range text {
+		if c != ' ' {
+			index := fontGlyphIndex(c)
+			rect := NewRect(x, y, fontGlyphW*TextScale, fontGlyphH*TextScale)
+			r.drawQuad(r.TextShader, rect, NewRect(float64(index)*glyphW, 0, glyphW, 1))
+		}
+		x += fontAdvance * TextScale
+	}
+
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func (r *GLRenderer) Present() {
+	r.window.GLSwap()
+}
+
+func (r *GLRenderer) Destroy() {
+	gl.DeleteBuffers(1, &r.vbo)
+	gl.DeleteVertexArrays(1, &r.vao)
+	gl.DeleteSamplers(gl.Sizei(samplingCount), &r.samplers[0])
+	gl.DeleteTextures(1, &r.sourceCurves)
+	gl.DeleteTextures(1, &r.displayCurves)
+	gl.DeleteTextures(1, &r.font)
+	gl.DeleteFramebuffers(1, &r.readFramebuffer)
+	r.QuadShader.Destroy()
+	r.ImageShader.Destroy()
+	r.TextShader.Destroy()
+}
+
+func setColorUniform(p *ShaderProgram, color Color) {
+	gl.Uniform4f(p.Uniform("color"), gl.Float(color.R), gl.Float(color.G), gl.Float(color.B), gl.Float(color.A))
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+const vertexShader = `
+#version 330 core
+
+uniform mat4 projection;
+
+layout(location = 0) in vec2 position;
+layout(location = 1) in vec2 texCoord;
+
+out vec2 fragTexCoord;
+out vec2 windowPosition;
+
+void main() {
+	fragTexCoord = texCoord;
+	windowPosition = position;
+	gl_Position = projection * vec4(position, 0.0, 1.0);
+}
+`
+
+// clipFunction is included in every fragment shader, it mirrors
+// Clip.Contains
+const clipFunction = `
+uniform int clipShape;
+uniform vec4 clipRect;
+
+in vec2 windowPosition;
+
+bool clipped() {
+	vec2 p = windowPosition - clipRect.xy;
+	if (clipShape == 1) {
+		return any(lessThan(p, vec2(0.0))) || any(greaterThanEqual(p, clipRect.zw));
+	}
+	if (clipShape == 2) {
+		vec2 d = (p - clipRect.zw / 2.0) / (clipRect.zw / 2.0);
+		return dot(d, d) > 1.0;
+	}
+	return false;
+}
+`
+
+const quadFragmentShader = `
+#version 330 core
+` + clipFunction + `
+uniform vec4 color;
+uniform vec4 darkColor;
+uniform float checkerboardSize;
+
+in vec2 fragTexCoord;
+
+out vec4 fragColor;
+
+void main() {
+	if (clipped()) {
+		discard;
+	}
+	fragColor = color;
+
+	if (checkerboardSize > 0.0) {
+		vec2 square = floor(fragTexCoord / checkerboardSize);
+		if (mod(square.x + square.y, 2.0) != 0.0) {
+			fragColor = darkColor;
+		}
+	}
+}
+`
+
+const textFragmentShader = `
+#version 330 core
+` + clipFunction + `
+uniform sampler2D fontTexture;
+uniform vec4 color;
+
+in vec2 fragTexCoord;
+
+out vec4 fragColor;
+
+void main() {
+	float coverage = texture(fontTexture, fragTexCoord).r;
+	if (clipped()) {
+		discard;
+	}
+	fragColor = vec4(color.rgb, color.a * coverage);
+}
+`
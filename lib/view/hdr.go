@@ -0,0 +1,182 @@
+package view
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// DecodeRadiance decodes a Radiance RGBE (.hdr) image into linear light.
+func DecodeRadiance(r io.Reader) (*FloatImage, error) {
+	reader := bufio.NewReader(r)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error while reading radiance header: %s", err)
+	}
+	if !strings.HasPrefix(line, "#?") {
+		return nil, fmt.Errorf("not a radiance file")
+	}
+
+	for {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("error while reading radiance header: %s", err)
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported radiance format: %s", line)
+		}
+	}
+
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error while reading radiance resolution: %s", err)
+	}
+
+	var yAxis, xAxis string
+	var w, h int
+	_, err = fmt.Sscanf(line, "%s %d %s %d", &yAxis, &h, &xAxis, &w)
+	if err != nil {
+		return nil, fmt.Errorf("invalid radiance resolution: %s", err)
+	}
+	if xAxis != "+X" || (yAxis != "-Y" && yAxis != "+Y") {
+		return nil, fmt.Errorf("unsupported radiance orientation: %s", strings.TrimSpace(line))
+	}
+	err = checkFloatImageSize(w, h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid radiance resolution: %s", err)
+	}
+
+	result := NewFloatImage(w, h, true)
+	scanline := make([]byte, w*4)
+
+	for y := 0; y < h; y++ {
+		err = readRadianceScanline(reader, scanline)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading radiance scanline %d: %s", y, err)
+		}
+
+		// +Y stores the bottom row first
+		row := y
+		if yAxis == "+Y" {
+			row = h - 1 - y
+		}
+
+		for x := 0; x < w; x++ {
+			r, g, b := rgbeToFloat(scanline[x*4:][:4])
+			result.Set(x, row, r, g, b, 1)
+		}
+	}
+
+	return result, nil
+}
+
+func readRadianceScanline(r *bufio.Reader, scanline []byte) error {
+	w := len(scanline) / 4
+
+	header, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	adaptive := w >= 8 && w < 0x8000 && header[0] == 2 && header[1] == 2 && header[2]&0x80 == 0
+	if !adaptive {
+		return readFlatRadianceScanline(r, scanline)
+	}
+
+	_, _ = r.Discard(4)
+	if int(header[2])<<8|int(header[3]) != w {
+		return fmt.Errorf("scanline width mismatch")
+	}
+
+	// each component is run length encoded separately
+	for c := 0; c < 4; c++ {
+		for x := 0; x < w; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+
+			if count > 128 {
+				n := int(count) - 128
+				if x+n > w {
+					return fmt.Errorf("run exceeds scanline")
+				}
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					scanline[x*4+c] = value
+					x++
+				}
+				continue
+			}
+
+			n := int(count)
+			if n == 0 || x+n > w {
+				return fmt.Errorf("invalid run length")
+			}
+			for ; n > 0; n-- {
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[x*4+c] = value
+				x++
+			}
+		}
+	}
+
+	return nil
+}
+
+func readFlatRadianceScanline(r *bufio.Reader, scanline []byte) error {
+	w := len(scanline) / 4
+	shift := 0
+
+	for x := 0; x < w; {
+		pixel := scanline[x*4:][:4]
+		_, err := io.ReadFull(r, pixel)
+		if err != nil {
+			return err
+		}
+
+		// old style run length encoding repeats the previous pixel
+		if pixel[0] == 1 && pixel[1] == 1 && pixel[2] == 1 {
+			if x == 0 {
+				return fmt.Errorf("run without preceding pixel")
+			}
+			n := int(pixel[3]) << shift
+			if x+n > w {
+				return fmt.Errorf("run exceeds scanline")
+			}
+			previous := scanline[(x-1)*4:][:4]
+			for ; n > 0; n-- {
+				copy(scanline[x*4:][:4], previous)
+				x++
+			}
+			shift += 8
+			continue
+		}
+
+		shift = 0
+		x++
+	}
+
+	return nil
+}
+
+func rgbeToFloat(rgbe []byte) (r, g, b float32) {
+	if rgbe[3] == 0 {
+		return 0, 0, 0
+	}
+	f := float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+	return float32(rgbe[0]) * f, float32(rgbe[1]) * f, float32(rgbe[2]) * f
+}
@@ -0,0 +1,137 @@
+package view
+
+import (
+	"bytes"
+	"testing"
+)
+
+func buildRadiance(resolution string, scanlines ...[]byte) []byte {
+	data := []byte("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\nEXPOSURE=1\n\n" + resolution + "\n")
+	for _, scanline := range scanlines {
+		data = append(data, scanline...)
+	}
+	return data
+}
+
+// the adaptive run length encoding stores the components one after another,
+// counts above 128 repeat the next byte
+func adaptiveRadianceScanline(w byte, components ...[]byte) []byte {
+	scanline := []byte{2, 2, 0, w}
+	for _, component := range components {
+		scanline = append(scanline, component...)
+	}
+	return scanline
+}
+
+func TestDecodeRadiance(t *testing.T) {
+	type pixel struct {
+		x, y     int
+		expected [3]float32
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		w, h   int
+		pixels []pixel
+	}{
+		{
+			"flat",
+			buildRadiance("-Y 2 +X 2",
+				[]byte{128, 64, 32, 129, 0, 0, 0, 0},
+				[]byte{128, 128, 128, 128, 255, 0, 0, 136},
+			),
+			2, 2,
+			[]pixel{
+				{0, 0, [3]float32{1, 0.5, 0.25}},
+				{1, 0, [3]float32{0, 0, 0}},
+				{0, 1, [3]float32{0.5, 0.5, 0.5}},
+				{1, 1, [3]float32{255, 0, 0}},
+			},
+		},
+		{
+			"bottom up",
+			buildRadiance("+Y 2 +X 1",
+				[]byte{128, 128, 128, 129},
+				[]byte{128, 128, 128, 128},
+			),
+			1, 2,
+			[]pixel{
+				{0, 0, [3]float32{0.5, 0.5, 0.5}},
+				{0, 1, [3]float32{1, 1, 1}},
+			},
+		},
+		{
+			"old run length encoding",
+			buildRadiance("-Y 1 +X 4", []byte{128, 64, 32, 129, 1, 1, 1, 3}),
+			4, 1,
+			[]pixel{
+				{0, 0, [3]float32{1, 0.5, 0.25}},
+				{3, 0, [3]float32{1, 0.5, 0.25}},
+			},
+		},
+		{
+			"adaptive run length encoding",
+			buildRadiance("-Y 1 +X 8", adaptiveRadianceScanline(8,
+				[]byte{128 + 8, 128},
+				[]byte{8, 16, 32, 48, 64, 80, 96, 112, 128},
+				[]byte{4, 0, 0, 0, 0, 128 + 4, 64},
+				[]byte{128 + 8, 129},
+			)),
+			8, 1,
+			[]pixel{
+				{0, 0, [3]float32{1, 0.125, 0}},
+				{4, 0, [3]float32{1, 0.625, 0.5}},
+				{7, 0, [3]float32{1, 1, 0.5}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i, err := DecodeRadiance(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if i.W != test.w || i.H != test.h || !i.Linear {
+				t.Fatalf("image is %dx%d, linear %t, expected %dx%d linear", i.W, i.H, i.Linear, test.w, test.h)
+			}
+			for _, p := range test.pixels {
+				var rgb [3]float32
+				copy(rgb[:], i.Pix[i.offset(p.x, p.y):])
+				if rgb != p.expected {
+					t.Errorf("pixel %d, %d is %v, expected %v", p.x, p.y, rgb, p.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRadianceInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not radiance", []byte("P6\n")},
+		{"unsupported format", []byte("#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n\x80\x80\x80\x80")},
+		{"unsupported orientation", buildRadiance("+X 1 -Y 1", []byte{128, 128, 128, 128})},
+		{"empty", buildRadiance("-Y 0 +X 1")},
+		{"too wide", buildRadiance("-Y 1 +X 65537")},
+		{"too many pixels", buildRadiance("-Y 65536 +X 65536")},
+		{"truncated", buildRadiance("-Y 2 +X 1", []byte{128, 128, 128, 128})},
+		{"run without preceding pixel", buildRadiance("-Y 1 +X 2", []byte{1, 1, 1, 2})},
+		{"old run exceeds scanline", buildRadiance("-Y 1 +X 2", []byte{128, 128, 128, 128, 1, 1, 1, 2})},
+		{"scanline width mismatch", buildRadiance("-Y 1 +X 8", adaptiveRadianceScanline(9))},
+		{"adaptive run exceeds scanline", buildRadiance("-Y 1 +X 8", adaptiveRadianceScanline(8, []byte{128 + 9, 0}))},
+		{"zero run length", buildRadiance("-Y 1 +X 8", adaptiveRadianceScanline(8, []byte{0}))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeRadiance(bytes.NewReader(test.data))
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
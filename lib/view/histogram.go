@@ -0,0 +1,247 @@
+package view
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+const HistogramBins = 256
+
+var (
+	HistogramBackgroundColor = NewColor(0, 0, 0, 0.7)
+	HistogramLuminanceColor  = NewColor(1, 1, 1, 0.9)
+	HistogramChannelColors   = [3]Color{
+		NewColor(1, 0.2, 0.2, 0.45),
+		NewColor(0.2, 1, 0.2, 0.45),
+		NewColor(0.3, 0.3, 1, 0.45),
+	}
+)
+
+const (
+	HistogramHeight  = 100
+	HistogramPadding = 8
+	// histogramSampleSize is the size from which the levels of a pyramid are
+	// good enough to compute the histogram from
+	histogramSampleSize = 1024
+)
+
+// Histogram counts the sRGB encoded values of the red, green and blue
+// channels and the luminance of the visible pixels of an image.
+type Histogram struct {
+	Channels [4][HistogramBins]int
+	// Mean is the average value of the red, green, blue and luminance
+	// channels, in 0..1
+	Mean [4]float64
+	// Pixels is the number of pixels that are not fully transparent
+	Pixels int
+	// Shadows and Highlights are the number of pixels of which a channel is
+	// clipped to black or white
+	Shadows    int
+	Highlights int
+}
+
+const (
+	HistogramRed = iota
+	HistogramGreen
+	HistogramBlue
+	HistogramLuminance
+)
+
+func (h *Histogram) add(r, g, b, a float64) {
+	if a <= 0 {
+		return
+	}
+
+	values := [4]float64{r, g, b, 0.2126*r + 0.7152*g + 0.0722*b}
+	for channel, value := range values {
+		bin := int(min(max(value, 0), 1)*(HistogramBins-1) + 0.5)
+		h.Channels[channel][bin]++
+		h.Mean[channel] += value
+	}
+	h.Pixels++
+
+	if r <= 0 || g <= 0 || b <= 0 {
+		h.Shadows++
+	}
+	if r >= 1 || g >= 1 || b >= 1 {
+		h.Highlights++
+	}
+}
+
+func (h *Histogram) finish() {
+	if h.Pixels == 0 {
+		return
+	}
+	for channel := range h.Mean {
+		h.Mean[channel] /= float64(h.Pixels)
+	}
+}
+
+// addImage counts the pixels of i within rect
+func (h *Histogram) addImage(i image.Image, rect image.Rectangle) {
+	switch p := i.(type) {
+	case *FloatImage:
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				o := p.offset(x, y)
+				r, g, b := float64(p.Pix[o+0]), float64(p.Pix[o+1]), float64(p.Pix[o+2])
+				if p.Linear {
+					r, g, b = linearToSrgb(min(max(r, 0), 1)), linearToSrgb(min(max(g, 0), 1)), linearToSrgb(min(max(b, 0), 1))
+				}
+				h.add(r, g, b, float64(p.Pix[o+3]))
+			}
+		}
+	case *image.NRGBA:
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			pix := p.Pix[p.PixOffset(rect.Min.X, y):][:rect.Dx()*4]
+			for o := 0; o < len(pix); o += 4 {
+				h.add(float64(pix[o+0])/0xff, float64(pix[o+1])/0xff, float64(pix[o+2])/0xff, float64(pix[o+3])/0xff)
+			}
+		}
+	default:
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				c := color.NRGBA64Model.Convert(i.At(x, y)).(color.NRGBA64)
+				h.add(float64(c.R)/0xffff, float64(c.G)/0xffff, float64(c.B)/0xffff, float64(c.A)/0xffff)
+			}
+		}
+	}
+}
+
+// NewHistogram counts the pixels of an image
+func NewHistogram(i image.Image) *Histogram {
+	h := &Histogram{}
+	h.addImage(i, i.Bounds())
+	h.finish()
+	return h
+}
+
+// newPyramidHistogram counts the pixels of the smallest level that is large
+// enough to be representative, overlapping tile borders are counted once.
+func newPyramidHistogram(source PyramidSource) (*Histogram, error) {
+	levels := source.Levels()
+	index := 0
+	for i := len(levels) - 1; i >= 0; i-- {
+		if max(levels[i].W, levels[i].H) >= histogramSampleSize {
+			index = i
+			break
+		}
+	}
+	level := levels[index]
+
+	h := &Histogram{}
+	for row := 0; row < level.Rows(); row++ {
+		for column := 0; column < level.Columns(); column++ {
+			pixels, rect, err := source.LoadTile(index, column, row)
+			if err != nil {
+				return nil, err
+			}
+
+			area := image.Rect(column*level.TileW, row*level.TileH, (column+1)*level.TileW, (row+1)*level.TileH)
+			area = area.Intersect(image.Rect(0, 0, level.W, level.H))
+			area = area.Sub(image.Pt(int(rect.X), int(rect.Y))).Add(pixels.Rect.Min)
+			h.addImage(pixels, area.Intersect(pixels.Rect))
+		}
+	}
+	h.finish()
+	return h, nil
+}
+
+// HistogramCommand delivers the histogram computed for a texture
+type HistogramCommand struct {
+	Texture   *Texture
+	Histogram *Histogram
+}
+
+// computeHistogram counts the pixels of the texture in the background and
+// posts the result
+func (m *Main) computeHistogram(t *Texture) {
+	m.histogram = nil
+
+	if t.pyramid != nil {
+		p := t.pyramid
+		// the source is closed once all workers are done
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			h, err := newPyramidHistogram(p.source)
+			if err != nil {
+				log.Printf("failed to compute histogram: %s", err)
+				return
+			}
+			m.PostCommand(HistogramCommand{Texture: t, Histogram: h})
+		}()
+		return
+	}
+
+	// the pixels are released once counted, the texture reads back values
+	// from the renderer
+	pixels := t.pixels
+	t.pixels = nil
+	if pixels == nil {
+		return
+	}
+	go func() {
+		m.PostCommand(HistogramCommand{Texture: t, Histogram: NewHistogram(pixels)})
+	}()
+}
+
+// DrawHistogram draws the histogram of the current image in the top right
+// corner of the window
+func (m *Main) DrawHistogram() {
+	h := m.histogram
+	if !m.Settings.Histogram || h == nil || h.Pixels == 0 {
+		return
+	}
+
+	lines := []string{
+		fmt.Sprintf("shadows %.2f%%", 100*float64(h.Shadows)/float64(h.Pixels)),
+		fmt.Sprintf("highlights %.2f%%", 100*float64(h.Highlights)/float64(h.Pixels)),
+		fmt.Sprintf("mean %d %d %d", toByte(h.Mean[HistogramRed]), toByte(h.Mean[HistogramGreen]), toByte(h.Mean[HistogramBlue])),
+	}
+
+	textH := float64(len(lines)) * LineHeight()
+	panel := NewRect(
+		m.View.W-HistogramBins-3*HistogramPadding,
+		HistogramPadding,
+		HistogramBins+2*HistogramPadding,
+		HistogramHeight+textH+3*HistogramPadding,
+	)
+	m.Renderer.DrawQuad(panel, HistogramBackgroundColor)
+
+	// the clipped ends are left out of the scale, they would flatten the rest
+	peak := 1
+	for _, channel := range h.Channels {
+		for _, count := range channel[1 : HistogramBins-1] {
+			peak = max(peak, count)
+		}
+	}
+
+	left := panel.X + HistogramPadding
+	bottom := panel.Y + HistogramPadding + HistogramHeight
+	height := func(count int) float64 {
+		return math.Round(math.Min(1, float64(count)/float64(peak)) * HistogramHeight)
+	}
+
+	for channel, color := range HistogramChannelColors {
+		for bin, count := range h.Channels[channel] {
+			barH := height(count)
+			if barH > 0 {
+				m.Renderer.DrawQuad(NewRect(left+float64(bin), bottom-barH, 1, barH), color)
+			}
+		}
+	}
+	for bin, count := range h.Channels[HistogramLuminance] {
+		barH := height(count)
+		if barH > 0 {
+			m.Renderer.DrawQuad(NewRect(left+float64(bin), bottom-barH, 1, 1), HistogramLuminanceColor)
+		}
+	}
+
+	for i, line := range lines {
+		m.Renderer.DrawText(line, left, bottom+HistogramPadding+float64(i)*LineHeight(), HistogramLuminanceColor)
+	}
+}
@@ -0,0 +1,298 @@
+package view
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"unicode/utf16"
+)
+
+// ColorProfile is a matrix/TRC based RGB color profile. ToXYZ converts linear
+// RGB to the D50 XYZ profile connection space, stored row major.
+type ColorProfile struct {
+	Name   string
+	ToXYZ  [9]float64
+	Curves [3]ToneCurve
+}
+
+// ToneCurve maps encoded values to linear light, both in the range [0, 1].
+type ToneCurve interface {
+	Eval(x float64) float64
+}
+
+type GammaCurve struct {
+	Gamma float64
+}
+
+func (c GammaCurve) Eval(x float64) float64 {
+	return math.Pow(max(x, 0), c.Gamma)
+}
+
+type TableCurve struct {
+	Table []float64
+}
+
+func (c TableCurve) Eval(x float64) float64 {
+	if len(c.Table) == 0 {
+		return x
+	}
+	position := min(max(x, 0), 1) * float64(len(c.Table)-1)
+	i := int(position)
+	if i >= len(c.Table)-1 {
+		return c.Table[len(c.Table)-1]
+	}
+	f := position - float64(i)
+	return c.Table[i]*(1-f) + c.Table[i+1]*f
+}
+
+// ParametricCurve implements the ICC parametric curve function types 0 to 4.
+type ParametricCurve struct {
+	Type                int
+	G, A, B, C, D, E, F float64
+}
+
+func (c ParametricCurve) Eval(x float64) float64 {
+	switch c.Type {
+	case 1:
+		if x >= -c.B/c.A {
+			return math.Pow(c.A*x+c.B, c.G)
+		}
+		return 0
+	case 2:
+		if x >= -c.B/c.A {
+			return math.Pow(c.A*x+c.B, c.G) + c.C
+		}
+		return c.C
+	case 3:
+		if x >= c.D {
+			return math.Pow(c.A*x+c.B, c.G)
+		}
+		return c.C * x
+	case 4:
+		if x >= c.D {
+			return math.Pow(c.A*x+c.B, c.G) + c.E
+		}
+		return c.C*x + c.F
+	}
+	return math.Pow(max(x, 0), c.G)
+}
+
+// InvertToneCurve finds the encoded value for linear value y, assuming the
+// curve is monotonically increasing.
+func InvertToneCurve(c ToneCurve, y float64) float64 {
+	low, high := 0.0, 1.0
+	for i := 0; i < 32; i++ {
+		middle := (low + high) / 2
+		if c.Eval(middle) < y {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return (low + high) / 2
+}
+
+var SRGBProfile = &ColorProfile{
+	Name: "sRGB",
+	ToXYZ: [9]float64{
+		0.4360747, 0.3850649, 0.1430804,
+		0.2225045, 0.7168786, 0.0606169,
+		0.0139322, 0.0971045, 0.7141733,
+	},
+	Curves: [3]ToneCurve{srgbCurve, srgbCurve, srgbCurve},
+}
+
+var srgbCurve = ParametricCurve{Type: 3, G: 2.4, A: 1 / 1.055, B: 0.055 / 1.055, C: 1 / 12.92, D: 0.04045}
+
+func LoadColorProfile(filename string) (*ColorProfile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading color profile: %s", err)
+	}
+	return ParseColorProfile(data)
+}
+
+// ParseColorProfile parses an ICC profile. Only RGB profiles described by
+// colorant tags and tone curves are supported, which covers the common
+// working spaces like sRGB, Adobe RGB and Display P3.
+func ParseColorProfile(data []byte) (*ColorProfile, error) {
+	if len(data) < 132 {
+		return nil, fmt.Errorf("icc profile too short")
+	}
+	if string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("invalid icc profile signature")
+	}
+	if string(data[16:20]) != "RGB " {
+		return nil, fmt.Errorf("unsupported icc color space: %q", data[16:20])
+	}
+	if string(data[20:24]) != "XYZ " {
+		return nil, fmt.Errorf("unsupported icc connection space: %q", data[20:24])
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, fmt.Errorf("icc tag table exceeds profile")
+		}
+		signature := string(data[entry : entry+4])
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("icc tag %q exceeds profile", signature)
+		}
+		tags[signature] = data[offset : offset+size]
+	}
+
+	profile := &ColorProfile{Name: parseICCDescription(tags["desc"])}
+
+	for column, signature := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := parseICCXYZ(tags[signature])
+		if err != nil {
+			return nil, fmt.Errorf("invalid icc tag %s: %s", signature, err)
+		}
+		for row := 0; row < 3; row++ {
+			profile.ToXYZ[row*3+column] = xyz[row]
+		}
+	}
+
+	for channel, signature := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseICCCurve(tags[signature])
+		if err != nil {
+			return nil, fmt.Errorf("invalid icc tag %s: %s", signature, err)
+		}
+		profile.Curves[channel] = curve
+	}
+
+	return profile, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseICCXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[0:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("missing or not an XYZ tag")
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+func parseICCCurve(tag []byte) (ToneCurve, error) {
+	if len(tag) < 12 {
+		return nil, fmt.Errorf("missing curve tag")
+	}
+
+	switch string(tag[0:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+count*2 {
+			return nil, fmt.Errorf("curve table exceeds tag")
+		}
+		if count == 0 {
+			return GammaCurve{Gamma: 1}, nil
+		}
+		if count == 1 {
+			return GammaCurve{Gamma: float64(binary.BigEndian.Uint16(tag[12:])) / 256}, nil
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return TableCurve{Table: table}, nil
+
+	case "para":
+		functionType := int(binary.BigEndian.Uint16(tag[8:]))
+		parameterCount := map[int]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}[functionType]
+		if parameterCount == 0 || len(tag) < 12+parameterCount*4 {
+			return nil, fmt.Errorf("invalid parametric curve")
+		}
+		p := make([]float64, 7)
+		for i := 0; i < parameterCount; i++ {
+			p[i] = s15Fixed16(tag[12+i*4:])
+		}
+		return ParametricCurve{Type: functionType, G: p[0], A: p[1], B: p[2], C: p[3], D: p[4], E: p[5], F: p[6]}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported curve type %q", tag[0:4])
+}
+
+func parseICCDescription(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+
+	switch string(tag[0:4]) {
+	case "desc":
+		length := int(binary.BigEndian.Uint32(tag[8:]))
+		if length <= 0 || 12+length > len(tag) {
+			return ""
+		}
+		text := tag[12 : 12+length]
+		for i, b := range text {
+			if b == 0 {
+				text = text[:i]
+				break
+			}
+		}
+		return string(text)
+
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(tag[20:]))
+		offset := int(binary.BigEndian.Uint32(tag[24:]))
+		if offset+length > len(tag) {
+			return ""
+		}
+		runes := make([]uint16, length/2)
+		for i := range runes {
+			runes[i] = binary.BigEndian.Uint16(tag[offset+i*2:])
+		}
+		return string(utf16.Decode(runes))
+	}
+
+	return ""
+}
+
+// ConversionMatrix returns the row major matrix converting linear RGB in this
+// profile to linear RGB in the target profile.
+func (p *ColorProfile) ConversionMatrix(target *ColorProfile) [9]float64 {
+	return multiplyMatrix3(invertMatrix3(target.ToXYZ), p.ToXYZ)
+}
+
+func multiplyMatrix3(a, b [9]float64) [9]float64 {
+	var result [9]float64
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			for i := 0; i < 3; i++ {
+				result[row*3+column] += a[row*3+i] * b[i*3+column]
+			}
+		}
+	}
+	return result
+}
+
+func invertMatrix3(m [9]float64) [9]float64 {
+	determinant := m[0]*(m[4]*m[8]-m[5]*m[7]) -
+		m[1]*(m[3]*m[8]-m[5]*m[6]) +
+		m[2]*(m[3]*m[7]-m[4]*m[6])
+	if determinant == 0 {
+		return [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	}
+
+	return [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) / determinant,
+		(m[2]*m[7] - m[1]*m[8]) / determinant,
+		(m[1]*m[5] - m[2]*m[4]) / determinant,
+		(m[5]*m[6] - m[3]*m[8]) / determinant,
+		(m[0]*m[8] - m[2]*m[6]) / determinant,
+		(m[2]*m[3] - m[0]*m[5]) / determinant,
+		(m[3]*m[7] - m[4]*m[6]) / determinant,
+		(m[1]*m[6] - m[0]*m[7]) / determinant,
+		(m[0]*m[4] - m[1]*m[3]) / determinant,
+	}
+}
@@ -0,0 +1,247 @@
+package view
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const tiffTagICCProfile = 34675
+
+// maxICCProfileSize limits the size of embedded profiles, sizes are read
+// from the file before the profile is allocated
+const maxICCProfileSize = 1 << 24
+
+// ReadColorProfile returns the ICC profile embedded in a JPEG, PNG, WebP or
+// TIFF file, or nil when the file does not carry one.
+func ReadColorProfile(filename string) (*ColorProfile, error) {
+	data, err := ReadEmbeddedICCProfile(filename)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return ParseColorProfile(data)
+}
+
+func ReadEmbeddedICCProfile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening file: %s", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 12)
+	_, err = io.ReadFull(f, magic)
+	if err != nil {
+		return nil, nil
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0xff, 0xd8}):
+		return readJPEGICCProfile(bufio.NewReader(f))
+	case bytes.HasPrefix(magic, []byte("\x89PNG\r\n\x1a\n")):
+		return readPNGICCProfile(bufio.NewReader(f))
+	case string(magic[0:4]) == "RIFF" && string(magic[8:12]) == "WEBP":
+		return readWebPICCProfile(bufio.NewReader(f))
+	case string(magic[0:4]) == "II*\x00" || string(magic[0:4]) == "MM\x00*":
+		return readTIFFICCProfile(f)
+	}
+
+	return nil, nil
+}
+
+// readJPEGICCProfile joins the profile chunks stored in APP2 segments.
+func readJPEGICCProfile(r *bufio.Reader) ([]byte, error) {
+	_, _ = r.Discard(2)
+
+	chunks := map[int][]byte{}
+	for {
+		marker := make([]byte, 2)
+		_, err := io.ReadFull(r, marker)
+		if err != nil {
+			break
+		}
+		if marker[0] != 0xff {
+			return nil, fmt.Errorf("invalid jpeg marker")
+		}
+		// start of scan or end of image, no more metadata
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			break
+		}
+
+		var length uint16
+		err = binary.Read(r, binary.BigEndian, &length)
+		if err != nil || length < 2 {
+			break
+		}
+		segment := make([]byte, length-2)
+		_, err = io.ReadFull(r, segment)
+		if err != nil {
+			break
+		}
+
+		if marker[1] == 0xe2 && len(segment) > 14 && string(segment[0:12]) == "ICC_PROFILE\x00" {
+			chunks[int(segment[12])] = segment[14:]
+		}
+	}
+
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	sequence := make([]int, 0, len(chunks))
+	for i := range chunks {
+		sequence = append(sequence, i)
+	}
+	sort.Ints(sequence)
+
+	var profile []byte
+	for _, i := range sequence {
+		profile = append(profile, chunks[i]...)
+	}
+	return profile, nil
+}
+
+func readPNGICCProfile(r *bufio.Reader) ([]byte, error) {
+	_, _ = r.Discard(8)
+
+	for {
+		var length uint32
+		err := binary.Read(r, binary.BigEndian, &length)
+		if err != nil {
+			return nil, nil
+		}
+		chunkType := make([]byte, 4)
+		_, err = io.ReadFull(r, chunkType)
+		if err != nil {
+			return nil, nil
+		}
+
+		// the profile has to appear before the image data
+		if string(chunkType) == "IDAT" || string(chunkType) == "IEND" {
+			return nil, nil
+		}
+
+		if string(chunkType) != "iCCP" {
+			_, err = r.Discard(int(length) + 4)
+			if err != nil {
+				return nil, nil
+			}
+			continue
+		}
+
+		if length > maxICCProfileSize {
+			return nil, fmt.Errorf("iCCP chunk too large: %d bytes", length)
+		}
+		data := make([]byte, length)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+
+		// profile name, null separator and compression method
+		separator := bytes.IndexByte(data, 0)
+		if separator < 0 || separator+2 > len(data) {
+			return nil, fmt.Errorf("invalid iCCP chunk")
+		}
+		z, err := zlib.NewReader(bytes.NewReader(data[separator+2:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid iCCP chunk: %s", err)
+		}
+		defer z.Close()
+		profile, err := io.ReadAll(io.LimitReader(z, maxICCProfileSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid iCCP chunk: %s", err)
+		}
+		if len(profile) > maxICCProfileSize {
+			return nil, fmt.Errorf("iCCP profile too large")
+		}
+		return profile, nil
+	}
+}
+
+func readWebPICCProfile(r *bufio.Reader) ([]byte, error) {
+	_, _ = r.Discard(12)
+
+	for {
+		header := make([]byte, 8)
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			return nil, nil
+		}
+		size := binary.LittleEndian.Uint32(header[4:])
+		// chunks are padded to an even size
+		padded := int(size) + int(size&1)
+
+		if string(header[0:4]) != "ICCP" {
+			_, err = r.Discard(padded)
+			if err != nil {
+				return nil, nil
+			}
+			continue
+		}
+
+		if size > maxICCProfileSize {
+			return nil, fmt.Errorf("ICCP chunk too large: %d bytes", size)
+		}
+		profile := make([]byte, size)
+		_, err = io.ReadFull(r, profile)
+		if err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+}
+
+func readTIFFICCProfile(r io.ReaderAt) ([]byte, error) {
+	header := make([]byte, 8)
+	_, err := r.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	ifd := int64(order.Uint32(header[4:]))
+	countBytes := make([]byte, 2)
+	_, err = r.ReadAt(countBytes, ifd)
+	if err != nil {
+		return nil, err
+	}
+	count := int64(order.Uint16(countBytes))
+
+	entry := make([]byte, 12)
+	for i := int64(0); i < count; i++ {
+		_, err = r.ReadAt(entry, ifd+2+i*12)
+		if err != nil {
+			return nil, err
+		}
+		if order.Uint16(entry[0:]) != tiffTagICCProfile {
+			continue
+		}
+
+		size := order.Uint32(entry[4:])
+		if size <= 4 || size > maxICCProfileSize {
+			return nil, fmt.Errorf("invalid tiff icc profile size: %d", size)
+		}
+		profile := make([]byte, size)
+		_, err = r.ReadAt(profile, int64(order.Uint32(entry[8:])))
+		if err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+
+	return nil, nil
+}
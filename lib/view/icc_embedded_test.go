@@ -0,0 +1,230 @@
+package view
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testEmbeddedProfile = bytes.Repeat([]byte("profile-"), 8)
+
+func jpegSegment(marker byte, data []byte) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+func jpegICCSegment(sequence, count byte, data []byte) []byte {
+	payload := append([]byte("ICC_PROFILE\x00"), sequence, count)
+	return jpegSegment(0xe2, append(payload, data...))
+}
+
+func buildJPEG(segments ...[]byte) []byte {
+	data := []byte{0xff, 0xd8}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, 0xff, 0xd9)
+}
+
+func encodePNGChunk(chunkType string, data []byte) []byte {
+	var b bytes.Buffer
+	writePNGChunk(&b, pngChunk{Type: chunkType, Data: data})
+	return b.Bytes()
+}
+
+func pngICCChunk(profile []byte) []byte {
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	_, _ = z.Write(profile)
+	_ = z.Close()
+	return encodePNGChunk("iCCP", append([]byte("icc\x00\x00"), compressed.Bytes()...))
+}
+
+func buildPNG(chunks ...[]byte) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = append(data, encodePNGChunk("IHDR", make([]byte, 13))...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, encodePNGChunk("IEND", nil)...)
+}
+
+func webpChunk(chunkType string, data []byte) []byte {
+	chunk := []byte(chunkType)
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func buildWebP(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(4+len(body)))
+	data = append(data, "WEBP"...)
+	return append(data, body...)
+}
+
+// buildTIFF returns a TIFF with an image width tag and, when profile is not
+// nil, a profile tag claiming size bytes
+func buildTIFF(order binary.AppendByteOrder, profile []byte, size uint32) []byte {
+	var data []byte
+	if order == binary.BigEndian {
+		data = []byte("MM\x00*")
+	} else {
+		data = []byte("II*\x00")
+	}
+	data = order.AppendUint32(data, 8)
+
+	entries := uint16(1)
+	if profile != nil {
+		entries++
+	}
+	data = order.AppendUint16(data, entries)
+
+	// ImageWidth, SHORT
+	data = order.AppendUint16(data, 256)
+	data = order.AppendUint16(data, 3)
+	data = order.AppendUint32(data, 1)
+	data = order.AppendUint32(data, 1)
+
+	if profile != nil {
+		// the profile follows the IFD and its next IFD offset
+		offset := uint32(len(data) + 12 + 4)
+		data = order.AppendUint16(data, tiffTagICCProfile)
+		data = order.AppendUint16(data, 7)
+		data = order.AppendUint32(data, size)
+		data = order.AppendUint32(data, offset)
+	}
+	data = order.AppendUint32(data, 0)
+	return append(data, profile...)
+}
+
+func readEmbeddedICCProfile(t *testing.T, data []byte) ([]byte, error) {
+	filename := filepath.Join(t.TempDir(), "image")
+	err := os.WriteFile(filename, data, 0644)
+	if err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	return ReadEmbeddedICCProfile(filename)
+}
+
+func TestReadEmbeddedICCProfile(t *testing.T) {
+	first, second := testEmbeddedProfile[:20], testEmbeddedProfile[20:]
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected []byte
+	}{
+		{"jpeg", buildJPEG(
+			jpegSegment(0xe0, []byte("JFIF\x00")),
+			jpegICCSegment(1, 1, testEmbeddedProfile),
+		), testEmbeddedProfile},
+		{"jpeg chunks out of order", buildJPEG(
+			jpegICCSegment(2, 2, second),
+			jpegSegment(0xe1, []byte("Exif\x00\x00")),
+			jpegICCSegment(1, 2, first),
+		), testEmbeddedProfile},
+		{"jpeg without profile", buildJPEG(
+			jpegSegment(0xe0, []byte("JFIF\x00")),
+		), nil},
+		{"jpeg profile after scan", buildJPEG(
+			jpegSegment(0xda, []byte{0}),
+			jpegICCSegment(1, 1, testEmbeddedProfile),
+		), nil},
+		{"png", buildPNG(
+			encodePNGChunk("pHYs", make([]byte, 9)),
+			pngICCChunk(testEmbeddedProfile),
+			encodePNGChunk("IDAT", []byte{1, 2, 3}),
+		), testEmbeddedProfile},
+		{"png without profile", buildPNG(
+			encodePNGChunk("IDAT", []byte{1, 2, 3}),
+		), nil},
+		{"png profile after data", buildPNG(
+			encodePNGChunk("IDAT", []byte{1, 2, 3}),
+			pngICCChunk(testEmbeddedProfile),
+		), nil},
+		{"webp", buildWebP(
+			webpChunk("VP8X", make([]byte, 10)),
+			webpChunk("ALPH", []byte{1, 2, 3}),
+			webpChunk("ICCP", testEmbeddedProfile),
+		), testEmbeddedProfile},
+		{"webp without profile", buildWebP(
+			webpChunk("VP8L", make([]byte, 5)),
+		), nil},
+		{"tiff little endian", buildTIFF(binary.LittleEndian, testEmbeddedProfile, uint32(len(testEmbeddedProfile))), testEmbeddedProfile},
+		{"tiff big endian", buildTIFF(binary.BigEndian, testEmbeddedProfile, uint32(len(testEmbeddedProfile))), testEmbeddedProfile},
+		{"tiff without profile", buildTIFF(binary.LittleEndian, nil, 0), nil},
+		{"unknown format", []byte("GIF89a\x01\x00\x01\x00\x00\x00"), nil},
+		{"shorter than magic", []byte{0xff, 0xd8}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, err := readEmbeddedICCProfile(t, test.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(profile, test.expected) {
+				t.Errorf("profile is %q, expected %q", profile, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadEmbeddedICCProfileOversized(t *testing.T) {
+	hugePNG := buildPNG(pngICCChunk(testEmbeddedProfile))
+	// the length of the iCCP chunk, after the signature and IHDR
+	binary.BigEndian.PutUint32(hugePNG[8+25:], math.MaxUint32)
+
+	hugeWebP := buildWebP(webpChunk("ICCP", testEmbeddedProfile))
+	binary.LittleEndian.PutUint32(hugeWebP[16:], math.MaxUint32)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"png chunk", hugePNG},
+		{"png decompressed profile", buildPNG(pngICCChunk(make([]byte, maxICCProfileSize+1)))},
+		{"webp chunk", hugeWebP},
+		{"tiff tag", buildTIFF(binary.LittleEndian, testEmbeddedProfile, math.MaxUint32)},
+		{"tiff profile beyond file", buildTIFF(binary.BigEndian, testEmbeddedProfile, uint32(len(testEmbeddedProfile)+1))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readEmbeddedICCProfile(t, test.data)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+// every truncation of a file either yields a profile, no profile or an
+// error, without reading beyond the data
+func TestReadEmbeddedICCProfileTruncated(t *testing.T) {
+	files := [][]byte{
+		buildJPEG(jpegICCSegment(1, 1, testEmbeddedProfile)),
+		buildPNG(pngICCChunk(testEmbeddedProfile)),
+		buildWebP(webpChunk("ICCP", testEmbeddedProfile)),
+		buildTIFF(binary.BigEndian, testEmbeddedProfile, uint32(len(testEmbeddedProfile))),
+	}
+
+	for _, data := range files {
+		for length := 0; length < len(data); length++ {
+			_, _ = readEmbeddedICCProfile(t, data[:length])
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package view
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"unicode/utf16"
+)
+
+type iccTag struct {
+	signature string
+	data      []byte
+}
+
+// buildICCProfile returns an RGB profile with the tags stored in order after
+// the tag table
+func buildICCProfile(tags ...iccTag) []byte {
+	data := make([]byte, 132+len(tags)*12)
+	copy(data[16:], "RGB XYZ ")
+	copy(data[36:], "acsp")
+	binary.BigEndian.PutUint32(data[128:], uint32(len(tags)))
+
+	for i, tag := range tags {
+		entry := data[132+i*12:]
+		copy(entry, tag.signature)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tag.data)))
+		data = append(data, tag.data...)
+	}
+	binary.BigEndian.PutUint32(data[0:], uint32(len(data)))
+	return data
+}
+
+func iccXYZ(x, y, z float64) []byte {
+	data := make([]byte, 20)
+	copy(data, "XYZ ")
+	for i, v := range []float64{x, y, z} {
+		binary.BigEndian.PutUint32(data[8+i*4:], uint32(int32(math.Round(v*65536))))
+	}
+	return data
+}
+
+func iccCurve(values ...uint16) []byte {
+	data := make([]byte, 12+len(values)*2)
+	copy(data, "curv")
+	binary.BigEndian.PutUint32(data[8:], uint32(len(values)))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[12+i*2:], v)
+	}
+	return data
+}
+
+func iccParametric(functionType uint16, parameters ...float64) []byte {
+	data := make([]byte, 12+len(parameters)*4)
+	copy(data, "para")
+	binary.BigEndian.PutUint16(data[8:], functionType)
+	for i, v := range parameters {
+		binary.BigEndian.PutUint32(data[12+i*4:], uint32(int32(math.Round(v*65536))))
+	}
+	return data
+}
+
+func iccDesc(text string) []byte {
+	data := make([]byte, 12, 12+len(text)+1)
+	copy(data, "desc")
+	binary.BigEndian.PutUint32(data[8:], uint32(len(text)+1))
+	return append(append(data, text...), 0)
+}
+
+func iccMluc(text string) []byte {
+	runes := utf16.Encode([]rune(text))
+	data := make([]byte, 28+len(runes)*2)
+	copy(data, "mluc")
+	binary.BigEndian.PutUint32(data[8:], 1)
+	binary.BigEndian.PutUint32(data[12:], 12)
+	copy(data[16:], "enUS")
+	binary.BigEndian.PutUint32(data[20:], uint32(len(runes)*2))
+	binary.BigEndian.PutUint32(data[24:], 28)
+	for i, r := range runes {
+		binary.BigEndian.PutUint16(data[28+i*2:], r)
+	}
+	return data
+}
+
+// testICCTags are the tags of a valid profile, with a different curve type
+// for every channel
+func testICCTags() []iccTag {
+	return []iccTag{
+		{"desc", iccDesc("Test RGB")},
+		{"rXYZ", iccXYZ(0.5, 0.25, 0.125)},
+		{"gXYZ", iccXYZ(0.375, 0.75, 0.0625)},
+		{"bXYZ", iccXYZ(0.125, 0.0625, 0.75)},
+		{"rTRC", iccCurve(563)},
+		{"gTRC", iccParametric(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)},
+		{"bTRC", iccCurve(0, 16384, 65535)},
+	}
+}
+
+func TestParseColorProfile(t *testing.T) {
+	profile, err := ParseColorProfile(buildICCProfile(testICCTags()...))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if profile.Name != "Test RGB" {
+		t.Errorf("name is %q", profile.Name)
+	}
+
+	// the colorants are the columns of the matrix
+	expected := [9]float64{
+		0.5, 0.375, 0.125,
+		0.25, 0.75, 0.0625,
+		0.125, 0.0625, 0.75,
+	}
+	if profile.ToXYZ != expected {
+		t.Errorf("matrix is %v, expected %v", profile.ToXYZ, expected)
+	}
+
+	curves := []struct {
+		x, y float64
+	}{
+		{0.5, math.Pow(0.5, 563.0/256)},
+		{0.5, srgbToLinear(0.5)},
+		{0.25, 0.125},
+	}
+	for channel, c := range curves {
+		y := profile.Curves[channel].Eval(c.x)
+		if math.Abs(y-c.y) > 1e-4 {
+			t.Errorf("curve %d at %g is %g, expected %g", channel, c.x, y, c.y)
+		}
+	}
+}
+
+func TestParseColorProfileMultiLocalizedName(t *testing.T) {
+	tags := testICCTags()
+	tags[0] = iccTag{"desc", iccMluc("Wide gamut ∆")}
+
+	profile, err := ParseColorProfile(buildICCProfile(tags...))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if profile.Name != "Wide gamut ∆" {
+		t.Errorf("name is %q", profile.Name)
+	}
+}
+
+func TestParseColorProfileErrors(t *testing.T) {
+	valid := func() []byte {
+		return buildICCProfile(testICCTags()...)
+	}
+	withTag := func(signature string, data []byte) []byte {
+		tags := testICCTags()
+		for i := range tags {
+			if tags[i].signature == signature {
+				tags[i].data = data
+			}
+		}
+		return buildICCProfile(tags...)
+	}
+	tagEntry := func(i int) int {
+		return 132 + i*12
+	}
+
+	tests := []struct {
+		name   string
+		modify func() []byte
+	}{
+		{"too short", func() []byte {
+			return valid()[:131]
+		}},
+		{"no signature", func() []byte {
+			data := valid()
+			copy(data[36:], "xxxx")
+			return data
+		}},
+		{"cmyk", func() []byte {
+			data := valid()
+			copy(data[16:], "CMYK")
+			return data
+		}},
+		{"lab connection space", func() []byte {
+			data := valid()
+			copy(data[20:], "Lab ")
+			return data
+		}},
+		{"tag table beyond data", func() []byte {
+			data := valid()
+			binary.BigEndian.PutUint32(data[128:], 1000)
+			return data
+		}},
+		{"maximum tag count", func() []byte {
+			data := valid()
+			binary.BigEndian.PutUint32(data[128:], math.MaxUint32)
+			return data
+		}},
+		{"tag offset beyond data", func() []byte {
+			data := valid()
+			binary.BigEndian.PutUint32(data[tagEntry(1)+4:], math.MaxUint32)
+			return data
+		}},
+		{"tag size beyond data", func() []byte {
+			data := valid()
+			binary.BigEndian.PutUint32(data[tagEntry(1)+8:], math.MaxUint32)
+			return data
+		}},
+		{"missing colorant", func() []byte {
+			tags := testICCTags()
+			return buildICCProfile(append(tags[:1], tags[2:]...)...)
+		}},
+		{"short colorant", func() []byte {
+			return withTag("gXYZ", iccXYZ(1, 1, 1)[:16])
+		}},
+		{"curve table beyond tag", func() []byte {
+			curve := iccCurve(0, 65535)
+			binary.BigEndian.PutUint32(curve[8:], math.MaxUint32)
+			return withTag("bTRC", curve)
+		}},
+		{"unknown parametric function", func() []byte {
+			return withTag("gTRC", iccParametric(5, 1, 1, 1, 1, 1, 1, 1, 1))
+		}},
+		{"short parametric curve", func() []byte {
+			return withTag("gTRC", iccParametric(4, 2.2, 1, 0))
+		}},
+		{"unknown curve type", func() []byte {
+			curve := iccCurve(563)
+			copy(curve, "sf32")
+			return withTag("rTRC", curve)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseColorProfile(test.modify())
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseColorProfileCorruptName(t *testing.T) {
+	desc := iccDesc("Name")
+	binary.BigEndian.PutUint32(desc[8:], math.MaxUint32)
+	mluc := iccMluc("Name")
+	binary.BigEndian.PutUint32(mluc[20:], math.MaxUint32)
+	binary.BigEndian.PutUint32(mluc[24:], math.MaxUint32)
+
+	for _, tag := range [][]byte{desc, mluc, desc[:11], mluc[:27]} {
+		tags := testICCTags()
+		tags[0].data = tag
+		profile, err := ParseColorProfile(buildICCProfile(tags...))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if profile.Name != "" {
+			t.Errorf("name of a corrupt tag is %q", profile.Name)
+		}
+	}
+}
+
+// every truncation of a profile is either parsed or rejected, without
+// reading beyond the data
+func TestParseColorProfileTruncated(t *testing.T) {
+	data := buildICCProfile(testICCTags()...)
+	for length := 0; length < len(data); length++ {
+		_, _ = ParseColorProfile(data[:length])
+	}
+}
+
+func TestTableCurve(t *testing.T) {
+	curve := TableCurve{Table: []float64{0, 0.5, 1}}
+	tests := []struct {
+		x, y float64
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.25, 0.25},
+		{0.75, 0.75},
+		{1, 1},
+		{2, 1},
+	}
+	for _, test := range tests {
+		if y := curve.Eval(test.x); math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("at %g is %g, expected %g", test.x, y, test.y)
+		}
+	}
+
+	if y := (TableCurve{}).Eval(0.3); y != 0.3 {
+		t.Errorf("empty table at 0.3 is %g", y)
+	}
+}
+
+func TestInvertToneCurve(t *testing.T) {
+	for _, x := range []float64{0, 0.01, 0.2, 0.5, 0.9, 1} {
+		y := srgbCurve.Eval(x)
+		if inverted := InvertToneCurve(srgbCurve, y); math.Abs(inverted-x) > 1e-6 {
+			t.Errorf("inverse of %g is %g, expected %g", y, inverted, x)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package view
+
+const imageFragmentShader = `
+#version 330 core
+` + clipFunction + `
+uniform sampler2D imageTexture;
+uniform int isLinear;
+uniform float exposure;
+uniform int toneMapOperator;
+uniform int displayMode;
+uniform float zebraWidth;
+
+uniform float brightness;
+uniform float contrast;
+uniform float gamma;
+uniform float saturation;
+uniform float blackPoint;
+uniform float whitePoint;
+
+uniform int colorManaged;
+uniform sampler1D sourceCurves;
+uniform sampler1D displayCurves;
+uniform float sourceCurveSize;
+uniform float displayCurveSize;
+uniform mat3 colorMatrix;
+
+in vec2 fragTexCoord;
+
+out vec4 fragColor;
+
+vec3 srgbToLinear(vec3 c) {
+	vec3 low = c / 12.92;
+	vec3 high = pow((c + 0.055) / 1.055, vec3(2.4));
+	return mix(low, high, step(vec3(0.04045), c));
+}
+
+vec3 linearToSrgb(vec3 c) {
+	vec3 low = c * 12.92;
+	vec3 high = 1.055 * pow(c, vec3(1.0 / 2.4)) - 0.055;
+	return mix(low, high, step(vec3(0.0031308), c));
+}
+
+vec3 lookup(sampler1D curves, float size, vec3 c) {
+	vec3 x = clamp(c, 0.0, 1.0) * (size - 1.0) / size + 0.5 / size;
+	return vec3(
+		texture(curves, x.r).r,
+		texture(curves, x.g).g,
+		texture(curves, x.b).b
+	);
+}
+
+vec3 reinhard(vec3 c) {
+	return c / (1.0 + c);
+}
+
+// Krzysztof Narkowicz's fit of the ACES filmic curve
+vec3 aces(vec3 c) {
+	c *= 0.6;
+	return (c * (2.51 * c + 0.03)) / (c * (2.43 * c + 0.59) + 0.14);
+}
+
+void main() {
+	// sampled before discarding, so the mipmap level is derived in uniform
+	// control flow
+	vec4 color = texture(imageTexture, fragTexCoord);
+	if (clipped()) {
+		discard;
+	}
+
+	vec3 c = max(color.rgb, vec3(0.0));
+	if (colorManaged == 1) {
+		if (isLinear == 0) {
+			c = lookup(sourceCurves, sourceCurveSize, c);
+		}
+		c = max(colorMatrix * c, vec3(0.0));
+	} else if (isLinear == 0) {
+		c = srgbToLinear(c);
+	}
+
+	c *= exp2(exposure);
+
+	if (toneMapOperator == 1) {
+		c = reinhard(c);
+	} else if (toneMapOperator == 2) {
+		c = aces(c);
+	}
+
+	if (colorManaged == 1) {
+		c = lookup(displayCurves, displayCurveSize, c);
+	} else {
+		c = linearToSrgb(clamp(c, 0.0, 1.0));
+	}
+
+	// adjustments, matching Adjustments.Apply
+	c = (c - blackPoint) / (whitePoint - blackPoint);
+	c = (c - 0.5) * contrast + 0.5 + brightness;
+	c = pow(clamp(c, 0.0, 1.0), vec3(1.0 / gamma));
+	float luminance = dot(c, vec3(0.2126, 0.7152, 0.0722));
+	c = clamp(luminance + (c - luminance) * saturation, 0.0, 1.0);
+
+	// display modes, matching DisplayMode.Apply
+	float alpha = color.a;
+	if (displayMode >= 1 && displayMode <= 4) {
+		c = vec3(vec4(c, color.a)[displayMode - 1]);
+		alpha = 1.0;
+	} else if (displayMode == 5) {
+		c = vec3(dot(c, vec3(0.2126, 0.7152, 0.0722)));
+	} else if (displayMode == 6) {
+		c = 1.0 - c;
+	} else if (displayMode == 7 && mod(floor((windowPosition.x + windowPosition.y + 0.5) / zebraWidth), 2.0) == 0.0) {
+		float high = max(c.r, max(c.g, c.b));
+		if (high >= 254.5 / 255.0) {
+			c = vec3(1.0, 0.0, 0.0);
+		} else if (high <= 0.5 / 255.0) {
+			c = vec3(0.0, 0.0, 1.0);
+		}
+	}
+
+	fragColor = vec4(c, alpha);
+}
+`
@@ -1,13 +1,8 @@
 package view
 
-import (
-	"github.com/veandco/go-sdl2/sdl"
-	"time"
-)
+import "github.com/veandco/go-sdl2/sdl"
 
 type InputHandler struct {
-	commandChannel chan<- interface{}
-
 	keyBinds  map[KeyMod]map[sdl.Keycode]interface{}
 	keyModMap map[uint16]KeyMod
 
@@ -36,28 +31,76 @@ const (
 	MouseWheelRight
 )
 
-func NewInputHandler(commandChannel chan<- interface{}) *InputHandler {
+func NewInputHandler() *InputHandler {
 	return &InputHandler{
-		commandChannel: commandChannel,
 		keyBinds: map[KeyMod]map[sdl.Keycode]interface{}{
 			KeyModNone: {
-				sdl.K_ESCAPE:    QuitCommand{},
-				sdl.K_PLUS:      ZoomCommand{Scale: 1.25},
-				sdl.K_KP_PLUS:   ZoomCommand{Scale: 1.25},
-				sdl.K_EQUALS:    ZoomCommand{Scale: 1.25},
-				sdl.K_KP_EQUALS: ZoomCommand{Scale: 1.25},
-				sdl.K_UP:        ZoomCommand{Scale: 1.25},
-				sdl.K_MINUS:     ZoomCommand{Scale: 0.8},
-				sdl.K_KP_MINUS:  ZoomCommand{Scale: 0.8},
-				sdl.K_DOWN:      ZoomCommand{Scale: 0.8},
-				sdl.K_1:         ZoomOriginalSizeCommand{},
-				sdl.K_f:         ZoomFitToWindowCommand{},
-				sdl.K_PAGEDOWN:  NextFileCommand{},
-				sdl.K_RIGHT:     NextFileCommand{},
-				sdl.K_PAGEUP:    PreviousFileCommand{},
-				sdl.K_LEFT:      PreviousFileCommand{},
-				sdl.K_HOME:      FirstFileCommand{},
-				sdl.K_END:       LastFileCommand{},
+				sdl.K_ESCAPE:       QuitCommand{},
+				sdl.K_PLUS:         ZoomCommand{Scale: 1.25},
+				sdl.K_KP_PLUS:      ZoomCommand{Scale: 1.25},
+				sdl.K_EQUALS:       ZoomCommand{Scale: 1.25},
+				sdl.K_KP_EQUALS:    ZoomCommand{Scale: 1.25},
+				sdl.K_UP:           ZoomCommand{Scale: 1.25},
+				sdl.K_MINUS:        ZoomCommand{Scale: 0.8},
+				sdl.K_KP_MINUS:     ZoomCommand{Scale: 0.8},
+				sdl.K_DOWN:         ZoomCommand{Scale: 0.8},
+				sdl.K_1:            FitCommand{Mode: FitOriginal},
+				sdl.K_f:            FitCommand{Mode: FitShrink},
+				sdl.K_w:            FitCommand{Mode: FitWidth},
+				sdl.K_m:            CycleFitModeCommand{},
+				sdl.K_l:            ToggleLockViewCommand{},
+				sdl.K_n:            ToggleNavigatorCommand{},
+				sdl.K_z:            ShowLoupeCommand{},
+				sdl.K_p:            ToggleInspectorCommand{},
+				sdl.K_d:            CycleDisplayModeCommand{},
+				sdl.K_a:            CycleAdjustmentCommand{},
+				sdl.K_x:            ToggleCompareCommand{},
+				sdl.K_PERIOD:       AdjustCommand{Steps: 1},
+				sdl.K_COMMA:        AdjustCommand{Steps: -1},
+				sdl.K_PAGEDOWN:     NextFileCommand{},
+				sdl.K_RIGHT:        NextFileCommand{},
+				sdl.K_PAGEUP:       PreviousFileCommand{},
+				sdl.K_LEFT:         PreviousFileCommand{},
+				sdl.K_HOME:         FirstFileCommand{},
+				sdl.K_END:          LastFileCommand{},
+				sdl.K_RIGHTBRACKET: ExposureCommand{EV: 0.5},
+				sdl.K_LEFTBRACKET:  ExposureCommand{EV: -0.5},
+				sdl.K_e:            ResetExposureCommand{},
+				sdl.K_t:            CycleToneMapOperatorCommand{},
+				sdl.K_c:            ToggleColorManagementCommand{},
+				sdl.K_i:            CycleTextureFilterCommand{},
+				sdl.K_g:            TogglePixelGridCommand{},
+				sdl.K_F11:          ToggleFullscreenCommand{},
+				sdl.K_b:            CycleBackgroundCommand{},
+				sdl.K_r:            RotateCommand{Degrees: 90},
+				sdl.K_h:            FlipHorizontalCommand{},
+				sdl.K_v:            FlipVerticalCommand{},
+			},
+			KeyModShift: {
+				sdl.K_f: FitCommand{Mode: FitAlways},
+				sdl.K_w: FitCommand{Mode: FitHeight},
+				sdl.K_m: FitCommand{Mode: FitFill},
+				sdl.K_l: ToggleRememberViewsCommand{},
+				sdl.K_z: ToggleLoupeShapeCommand{},
+				sdl.K_h: ToggleHistogramCommand{},
+				sdl.K_b: ToggleCheckerboardCommand{},
+				sdl.K_a: ResetAdjustmentsCommand{},
+				sdl.K_x: SwapCompareCommand{},
+
+				sdl.K_UP:   LoupeFactorCommand{Scale: 1.25},
+				sdl.K_DOWN: LoupeFactorCommand{Scale: 0.8},
+				sdl.K_r:    RotateCommand{Degrees: -90},
+			},
+			KeyModAlt: {
+				sdl.K_RETURN: ToggleFullscreenCommand{},
+
+				sdl.K_r: DisplayModeCommand{Mode: DisplayRed},
+				sdl.K_g: DisplayModeCommand{Mode: DisplayGreen},
+				sdl.K_b: DisplayModeCommand{Mode: DisplayBlue},
+				sdl.K_a: DisplayModeCommand{Mode: DisplayAlpha},
+				sdl.K_l: DisplayModeCommand{Mode: DisplayLuminance},
+				sdl.K_i: DisplayModeCommand{Mode: DisplayInverted},
+				sdl.K_z: DisplayModeCommand{Mode: DisplayZebra},
 			},
 			KeyModControl: {
 				sdl.K_w:     QuitCommand{},
@@ -65,6 +108,13 @@ func NewInputHandler(commandChannel chan<- interface{}) *InputHandler {
 				sdl.K_RIGHT: MoveViewCommand{X: 10},
 				sdl.K_UP:    MoveViewCommand{Y: -10},
 				sdl.K_DOWN:  MoveViewCommand{Y: 10},
+
+				sdl.K_RIGHTBRACKET: RotateCommand{Degrees: 1},
+				sdl.K_LEFTBRACKET:  RotateCommand{Degrees: -1},
+				sdl.K_r:            ResetRotationCommand{},
+				sdl.K_s:            SaveOrientationCommand{},
+				sdl.K_c:            CopyPixelCommand{},
+				sdl.K_a:            ToggleStickyAdjustmentsCommand{},
 			},
 		},
 		keyModMap: map[uint16]KeyMod{
@@ -89,114 +139,139 @@ func NewInputHandler(commandChannel chan<- interface{}) *InputHandler {
 	}
 }
 
-func (h *InputHandler) Run() {
+// Translate turns an SDL event into the commands bound to it. It keeps track
+// of the modifier keys, so events have to be passed in order.
+func (h *InputHandler) Translate(e sdl.Event) []interface{} {
+	var commands []interface{}
 
-	go func() {
-		for {
-			e := sdl.PollEvent()
+	switch e.(type) {
+	case *sdl.QuitEvent:
+		commands = append(commands, QuitCommand{})
 
-			if e == nil {
-				time.Sleep(20 * time.Millisecond)
-				continue
-			}
+	case *sdl.MouseWheelEvent:
+		m := e.(*sdl.MouseWheelEvent)
 
-			switch e.(type) {
-			case *sdl.QuitEvent:
-				h.commandChannel <- QuitCommand{}
+		var direction MouseWheel
+		if m.X < 0 {
+			direction = MouseWheelLeft
+		}
+		if m.X > 0 {
+			direction = MouseWheelRight
+		}
+		if m.Y < 0 {
+			direction = MouseWheelDown
+		}
+		if m.Y > 0 {
+			direction = MouseWheelUp
+		}
 
-			case *sdl.MouseWheelEvent:
-				m := e.(*sdl.MouseWheelEvent)
+		modBinds, ok := h.mouseWheelBinds[h.currentKeyMod]
+		if !ok {
+			return nil
+		}
+		command, ok := modBinds[direction]
+		if !ok {
+			return nil
+		}
+		commands = append(commands, command)
 
-				var direction MouseWheel
-				if m.X < 0 {
-					direction = MouseWheelLeft
-				}
-				if m.X > 0 {
-					direction = MouseWheelRight
-				}
-				if m.Y < 0 {
-					direction = MouseWheelDown
-				}
-				if m.Y > 0 {
-					direction = MouseWheelUp
-				}
+	case *sdl.MouseMotionEvent:
+		m := e.(*sdl.MouseMotionEvent)
+		commands = append(commands, MouseCursorPositionCommand{
+			X: float64(m.X),
+			Y: float64(m.Y),
+		})
 
-				modBinds, ok := h.mouseWheelBinds[h.currentKeyMod]
-				if !ok {
-					continue
-				}
-				command, ok := modBinds[direction]
-				if !ok {
-					continue
-				}
-				h.commandChannel <- command
+	case *sdl.MouseButtonEvent:
+		m := e.(*sdl.MouseButtonEvent)
+		if m.Button == sdl.BUTTON_LEFT {
+			if m.State == sdl.PRESSED {
+				commands = append(commands, StartDragLeftCommand{})
+			} else {
+				commands = append(commands, StopDragLeftCommand{})
+			}
+		}
+		if m.Button == sdl.BUTTON_MIDDLE {
+			if m.State == sdl.PRESSED {
+				commands = append(commands, ShowLoupeCommand{})
+			} else {
+				commands = append(commands, HideLoupeCommand{})
+			}
+		}
+		if m.Button == sdl.BUTTON_RIGHT {
+			if m.State == sdl.PRESSED {
+				commands = append(commands, StartDragRightCommand{})
+			} else {
+				commands = append(commands, StopDragRightCommand{})
+			}
+		}
 
-			case *sdl.MouseMotionEvent:
-				m := e.(*sdl.MouseMotionEvent)
-				h.commandChannel <- MouseCursorPositionCommand{
-					X: float64(m.X),
-					Y: float64(m.Y),
-				}
+	case *sdl.KeyboardEvent:
+		k := e.(*sdl.KeyboardEvent)
 
-			case *sdl.MouseButtonEvent:
-				m := e.(*sdl.MouseButtonEvent)
-				if m.Button == sdl.BUTTON_LEFT {
-					if m.State == sdl.PRESSED {
-						h.commandChannel <- StartDragLeftCommand{}
-					} else {
-						h.commandChannel <- StopDragLeftCommand{}
-					}
+		if k.Type == sdl.KEYDOWN {
+			for sdlMod, keyMod := range h.keyModMap {
+				if k.Keysym.Mod&sdlMod != 0 {
+					h.currentKeyMod |= keyMod
 				}
-				if m.Button == sdl.BUTTON_RIGHT {
-					if m.State == sdl.PRESSED {
-						h.commandChannel <- StartDragRightCommand{}
-					} else {
-						h.commandChannel <- StopDragRightCommand{}
-					}
+			}
+		}
+		if k.Type == sdl.KEYUP {
+			for sdlMod, keyMod := range h.keyModMap {
+				if k.Keysym.Mod&sdlMod == 0 {
+					h.currentKeyMod &^= keyMod
 				}
+			}
+		}
 
-			case *sdl.KeyboardEvent:
-				k := e.(*sdl.KeyboardEvent)
+		if k.Type == sdl.KEYUP {
+			if command := h.releaseCommand(k.Keysym.Sym); command != nil {
+				return []interface{}{command}
+			}
+		}
 
-				if k.Type == sdl.KEYDOWN {
-					for sdlMod, keyMod := range h.keyModMap {
-						if k.Keysym.Mod&sdlMod != 0 {
-							h.currentKeyMod |= keyMod
-						}
-					}
-				}
-				if k.Type == sdl.KEYUP {
-					for sdlMod, keyMod := range h.keyModMap {
-						if k.Keysym.Mod&sdlMod == 0 {
-							h.currentKeyMod &^= keyMod
-						}
-					}
-				}
+		if k.Type != sdl.KEYDOWN {
+			return nil
+		}
 
-				if k.Type != sdl.KEYDOWN {
-					continue
-				}
+		modBinds, ok := h.keyBinds[h.currentKeyMod]
+		if !ok {
+			return nil
+		}
+		command, ok := modBinds[k.Keysym.Sym]
+		if !ok {
+			return nil
+		}
+		if zoom, ok := command.(ZoomCommand); ok {
+			zoom.Held = true
+			zoom.Repeat = k.Repeat != 0
+			command = zoom
+		}
+		commands = append(commands, command)
 
-				modBinds, ok := h.keyBinds[h.currentKeyMod]
-				if !ok {
-					continue
-				}
-				command, ok := modBinds[k.Keysym.Sym]
-				if !ok {
-					continue
-				}
-				h.commandChannel <- command
+	case *sdl.WindowEvent:
+		w := e.(*sdl.WindowEvent)
+		if w.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
+			commands = append(commands, UpdateWindowSizeCommand{W: float64(w.Data1), H: float64(w.Data2)}, SaveSettingsCommand{})
+		}
+		if w.Event == sdl.WINDOWEVENT_MOVED {
+			commands = append(commands, SaveSettingsCommand{})
+		}
+	}
 
-			case *sdl.WindowEvent:
-				w := e.(*sdl.WindowEvent)
-				if w.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
-					h.commandChannel <- UpdateWindowSizeCommand{W: float64(w.Data1), H: float64(w.Data2)}
-					h.commandChannel <- SaveSettingsCommand{}
-				}
-				if w.Event == sdl.WINDOWEVENT_MOVED {
-					h.commandChannel <- SaveSettingsCommand{}
-				}
-			}
+	return commands
+}
+
+// releaseCommand returns the command ending what a held key started. The key
+// is looked up with any modifier, as the modifier may be released first.
+func (h *InputHandler) releaseCommand(key sdl.Keycode) interface{} {
+	for _, modBinds := range h.keyBinds {
+		switch modBinds[key].(type) {
+		case ZoomCommand:
+			return StopZoomCommand{}
+		case ShowLoupeCommand:
+			return HideLoupeCommand{}
 		}
-	}()
+	}
+	return nil
 }
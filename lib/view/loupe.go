@@ -0,0 +1,58 @@
+package view
+
+var LoupeBorderColor = NewColor(0.9, 0.9, 0.9, 0.9)
+
+const LoupeBorderWidth = 2
+
+type LoupeSettings struct {
+	// Factor is the magnification relative to the view
+	Factor float64
+	// Size is the width and height of the loupe in pixels
+	Size float64
+	// Round shows a circle instead of a square
+	Round bool
+}
+
+// DrawLoupe draws a magnified part of the image around the mouse cursor while
+// the loupe is held, in each pane when comparing
+func (m *Main) DrawLoupe(options ImageOptions) {
+	if !m.Loupe || m.Texture == nil {
+		return
+	}
+
+	for _, p := range m.panes() {
+		m.drawLoupe(p.texture, p.view(m.View), m.Mouse.X+p.offset, m.Mouse.Y, options)
+	}
+}
+
+// drawLoupe draws the loupe for a texture placed by view, centered at the
+// window position x, y
+func (m *Main) drawLoupe(t *Texture, view View, x, y float64, options ImageOptions) {
+	size := m.Settings.Loupe.Size
+	rect := NewRect(x-size/2, y-size/2, size, size)
+	border := NewRect(rect.X-LoupeBorderWidth, rect.Y-LoupeBorderWidth, rect.W+2*LoupeBorderWidth, rect.H+2*LoupeBorderWidth)
+
+	shape := ClipRect
+	if m.Settings.Loupe.Round {
+		shape = ClipEllipse
+	}
+
+	m.Renderer.SetClip(Clip{Shape: shape, Rect: border})
+	m.Renderer.DrawQuad(border, LoupeBorderColor)
+
+	m.Renderer.SetClip(Clip{Shape: shape, Rect: rect})
+	m.Renderer.DrawQuad(rect, m.backgroundColor())
+
+	if t != nil {
+		// the view zoomed in around the mouse cursor
+		factor := m.Settings.Loupe.Factor
+		view.X = x + (view.X-x)*factor
+		view.Y = y + (view.Y-y)*factor
+		view.Scale *= factor
+
+		options.Sampling = m.TextureFilter.Sampling(view.Scale, m.Settings.NearestFilterThreshold)
+		m.drawView(t, view, rect, options)
+	}
+
+	m.Renderer.SetClip(Clip{})
+}
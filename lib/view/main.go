@@ -2,10 +2,10 @@ package view
 
 import (
 	"fmt"
+	"log"
 	"path/filepath"
 	"time"
 
-	gl "github.com/chsc/gogl/gl21"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -19,32 +19,80 @@ var (
 )
 
 type Main struct {
-	Window   *sdl.Window
-	Renderer *sdl.Renderer
-	Context  sdl.GLContext
+	Window      *sdl.Window
+	SDLRenderer *sdl.Renderer
+	Context     sdl.GLContext
 
-	Running bool
+	Running    bool
+	Fullscreen bool
+	// dirty is set when the view changed since the last frame
+	dirty      bool
+	animations []Animation
+
+	// Commands receives commands from other goroutines, sent with
+	// PostCommand so the main thread wakes up
+	Commands  chan interface{}
+	wakeEvent uint32
 
 	Filename   string
 	FileCursor *FileCursor
 
+	// CompareDirectory starts comparing with the files of the same name in
+	// this directory
+	CompareDirectory string
+	Compare          *Compare
+	// mouseRightPane is set while the mouse is over the right pane
+	mouseRightPane bool
+
 	Settings Settings
 
+	Renderer        Renderer
+	ToneMapping     ToneMapping
+	ColorManagement ColorManagement
+	TextureFilter   TextureFilter
+	DisplayMode     DisplayMode
+	Adjustments     Adjustments
+
+	// adjustment is the adjustment changed by the adjust commands, adjusting
+	// shows the adjustments while they are selected
+	adjustment Adjustment
+	adjusting  bool
+
 	Texture *Texture
 	View    View
 	Mouse   Mouse
-}
 
-type View struct {
-	X, Y  float64
-	W, H  float64
-	Scale float64
+	// windowW is the width of the window, the view is narrower when comparing
+	windowW float64
+
+	// histogram is that of Texture, nil until it is computed
+	histogram *Histogram
+
+	// Loupe is set while the magnifier is held
+	Loupe bool
+	// Inspector shows the value of the pixel under the mouse cursor
+	Inspector bool
+
+	// LockView keeps the view as it is when another file is loaded
+	LockView bool
+	// views are the views of the files shown before, by filename
+	views map[string]View
+
+	zoom         *zoomAnimation
+	pan          *kineticPan
+	panTime      time.Time
+	panVX, panVY float64
+
+	lastCursorActivity time.Time
+	cursorHidden       bool
+	hideCursorTimer    *time.Timer
 }
 
 func NewMain(filename string) *Main {
 	return &Main{
-		Filename: filename,
-		View:     View{Scale: 1},
+		Filename:    filename,
+		View:        View{Scale: 1},
+		Adjustments: DefaultAdjustments,
 	}
 }
 
@@ -58,6 +106,8 @@ func (m *Main) Run() error {
 	defer sdl.Quit()
 
 	m.Settings = LoadSettings()
+	m.ToneMapping.Operator = m.Settings.ToneMapOperator
+	m.TextureFilter = m.Settings.TextureFilter
 
 	_ = sdl.GLSetAttribute(sdl.GL_CONTEXT_MAJOR_VERSION, 3)
 	_ = sdl.GLSetAttribute(sdl.GL_CONTEXT_MINOR_VERSION, 3)
@@ -72,13 +122,13 @@ func (m *Main) Run() error {
 		return err
 	}
 
-	m.Renderer, err = sdl.CreateRenderer(m.Window, -1, 0)
+	m.SDLRenderer, err = sdl.CreateRenderer(m.Window, -1, 0)
 	if err != nil {
 		return err
 	}
-	defer m.Renderer.Destroy()
+	defer m.SDLRenderer.Destroy()
 
-	info, err := m.Renderer.GetInfo()
+	info, err := m.SDLRenderer.GetInfo()
 	if err != nil {
 		return err
 	}
@@ -93,10 +143,11 @@ func (m *Main) Run() error {
 		return fmt.Errorf("failed to create opengl context")
 	}
 
-	err = m.InitGL()
+	err = m.InitRenderer()
 	if err != nil {
 		return err
 	}
+	defer m.Renderer.Destroy()
 
 	if len(m.Filename) != 0 {
 		m.FileCursor, err = NewFileCursorFromFilename(m.Filename)
@@ -110,36 +161,48 @@ func (m *Main) Run() error {
 		}
 	}
 
+	m.Commands = make(chan interface{}, 10)
+	m.wakeEvent = sdl.RegisterEvents(1)
+	if m.wakeEvent == ^uint32(0) {
+		return fmt.Errorf("failed to register wake event: %s", sdl.GetError())
+	}
+
 	err = m.LoadFile()
 	if err != nil {
 		return err
 	}
 
-	commandChannel := make(chan interface{}, 10)
-	inputHandler := NewInputHandler(commandChannel)
-	inputHandler.Run()
+	if len(m.CompareDirectory) != 0 {
+		m.StartCompare(CompareDirectory, m.CompareDirectory)
+	}
+
+	if m.Settings.Window.Fullscreen {
+		m.SetFullscreen(true)
+	}
 
-	commandHandler := NewCommandHandler(m, commandChannel)
+	commandHandler := NewCommandHandler(m, m.Commands, NewInputHandler())
 
 	// Main stuff
 	m.Running = true
+	m.Invalidate()
 	for m.Running {
-		gl.Clear(gl.COLOR_BUFFER_BIT)
-
-		if m.Texture != nil {
-			m.Texture.DrawScale(m.View.X, m.View.Y, m.View.Scale)
+		if m.dirty || m.Animating() {
+			m.animate(time.Now())
+			m.Draw()
+			m.Renderer.Present()
+			m.dirty = false
 		}
 
-		if m.Mouse.DragLeft.Dragging {
-			rect := m.Mouse.DragLeftRect()
-			if rect.W >= DragThreshold || rect.H >= DragThreshold {
-				DrawQuadBorder(rect, DragColor, DragBorderWidth, DragBorderColor)
-			}
+		// without animations there is nothing to do until a command arrives
+		var timeout time.Duration
+		if m.Animating() {
+			timeout = FrameInterval
 		}
+		commandHandler.HandleUntilDirty(timeout)
+	}
 
-		m.Window.GLSwap()
-
-		commandHandler.HandleBlockingOrAtLeast(5 * time.Millisecond)
+	if m.hideCursorTimer != nil {
+		m.hideCursorTimer.Stop()
 	}
 
 	m.SaveSettings()
@@ -147,104 +210,238 @@ func (m *Main) Run() error {
 	return nil
 }
 
-func (m *Main) InitGL() error {
-	err := gl.Init()
+func (m *Main) InitRenderer() error {
+	var err error
+
+	m.Renderer, err = NewGLRenderer(m.Window)
 	if err != nil {
-		return fmt.Errorf("failed to initialize opengl")
+		return err
 	}
 
-	gl.ClearColor(0.2, 0.2, 0.2, 1.0)
-
-	gl.Enable(gl.TEXTURE_2D)
-
-	gl.Enable(gl.BLEND)
-	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	display := SRGBProfile
+	if len(m.Settings.DisplayProfile) != 0 {
+		display, err = LoadColorProfile(m.Settings.DisplayProfile)
+		if err != nil {
+			log.Printf("failed to load display profile, using sRGB: %s", err)
+			display = SRGBProfile
+		}
+	}
+	m.ColorManagement = ColorManagement{
+		Enabled: m.Settings.ColorManagement,
+		Display: display,
+	}
 
-	m.ResetGLView(float64(m.Settings.Window.W), float64(m.Settings.Window.H))
+	m.ResetView(float64(m.Settings.Window.W), float64(m.Settings.Window.H))
 
 	return nil
 }
 
-func (m *Main) ResetGLView(w, h float64) {
-	gl.Viewport(0, 0, gl.Sizei(w), gl.Sizei(h))
-
-	gl.MatrixMode(gl.PROJECTION)
-	gl.LoadIdentity()
-
-	gl.Ortho(gl.Double(0), gl.Double(w), gl.Double(h), gl.Double(0), gl.Double(-1.0), gl.Double(1.0))
-
-	gl.MatrixMode(gl.MODELVIEW)
-	gl.LoadIdentity()
+func (m *Main) ResetView(w, h float64) {
+	m.Renderer.SetViewport(w, h)
 
+	m.windowW = w
+	if m.Compare != nil {
+		w = paneWidth(w)
+	}
 	m.View.W = w
 	m.View.H = h
 	m.View.X = w / 2
 	m.View.Y = h / 2
 }
 
+// Draw draws a frame with the current renderer, which is presented by the
+// caller.
+func (m *Main) Draw() {
+	m.Renderer.Clear(m.backgroundColor())
+
+	if m.Texture != nil {
+		options := ImageOptions{
+			Sampling:        m.TextureFilter.Sampling(m.View.Scale, m.Settings.NearestFilterThreshold),
+			ToneMapping:     m.ToneMapping,
+			ColorManagement: m.ColorManagement,
+			DisplayMode:     m.DisplayMode,
+			Adjustments:     m.Adjustments,
+		}
+
+		panes := m.panes()
+		for _, p := range panes {
+			if p.texture != nil {
+				p.texture.BeginFrame(m.Renderer)
+			}
+		}
+
+		m.drawPanes(options)
+
+		m.DrawNavigator(options)
+		m.DrawLoupe(options)
+		m.DrawInspector()
+		m.DrawHistogram()
+		m.DrawAdjustments()
+
+		for _, p := range panes {
+			if p.texture != nil {
+				p.texture.EndFrame()
+			}
+		}
+	}
+
+	if m.Mouse.DragLeft.Dragging {
+		rect := m.Mouse.DragLeftRect()
+		rect.X += m.mousePaneOffset()
+		if rect.W >= DragThreshold || rect.H >= DragThreshold {
+			DrawQuadBorder(m.Renderer, rect, DragColor, DragBorderWidth, DragBorderColor)
+		}
+	}
+}
+
+// drawView draws a texture placed by view, with the checkerboard behind it
+// and the pixel grid on top, limited to the area of the window.
+func (m *Main) drawView(t *Texture, view View, area Rect, options ImageOptions) {
+	// the image is drawn unrotated with the view transform applied, so the
+	// area is clipped in image space
+	transform := view.Transform()
+	clip := transform.Invert().BoundingRect(area)
+
+	m.Renderer.SetTransform(transform)
+	m.drawCheckerboard(t, view, clip)
+	t.DrawScaleClipped(m.Renderer, view.X, view.Y, view.Scale, clip, options)
+
+	if m.Settings.PixelGrid.Enabled && view.Scale > m.Settings.PixelGrid.Threshold {
+		DrawPixelGrid(m.Renderer, t, view, clip, m.Settings.PixelGrid.Color)
+	}
+	m.Renderer.SetTransform(IdentityTransform)
+}
+
 func (m *Main) SaveSettings() {
-	x, y := m.Window.GetPosition()
-	w, h := m.Window.GetSize()
-	settings := Settings{
-		Window: WindowSettings{
-			X: uint32(x),
-			Y: uint32(y),
-			W: uint32(w),
-			H: uint32(h),
-		},
-	}
-	m.Settings = settings
+	m.storeWindowGeometry()
+	m.Settings.Window.Fullscreen = m.Fullscreen
+	m.Settings.ToneMapOperator = m.ToneMapping.Operator
+	m.Settings.ColorManagement = m.ColorManagement.Enabled
+	m.Settings.TextureFilter = m.TextureFilter
 	SaveSettings(m.Settings)
 }
 
-func (m *Main) FitToWindow() {
+// Invalidate marks the view to be drawn again in the next frame
+func (m *Main) Invalidate() {
+	m.dirty = true
+}
+
+// PostCommand queues a command from another goroutine and wakes up the main
+// thread, which may be waiting for SDL events. It blocks while the queue is
+// full, so it must not be called from the main thread.
+func (m *Main) PostCommand(command interface{}) {
+	m.Commands <- command
+	m.wake()
+}
+
+// RequestRedraw wakes up the main loop to draw a new frame, it is safe to call
+// from any goroutine.
+func (m *Main) RequestRedraw() {
+	select {
+	case m.Commands <- RedrawCommand{}:
+		m.wake()
+	default:
+		// the queued commands will trigger a redraw
+	}
+}
+
+func (m *Main) wake() {
+	_, err := sdl.PushEvent(&sdl.UserEvent{Type: m.wakeEvent})
+	if err != nil {
+		log.Printf("failed to wake up main loop: %s", err)
+	}
+}
+
+func (m *Main) UpdateWindowTitle() {
 	if m.Texture == nil {
+		m.Window.SetTitle(WindowTitle)
 		return
 	}
 
-	if m.Texture.W > m.View.W || m.Texture.H > m.View.H {
-		windowRatio := m.View.W / m.View.H
-		textureRatio := m.Texture.W / m.Texture.H
-
-		if windowRatio > textureRatio {
-			m.View.Scale = m.View.H / m.Texture.H
-		} else {
-			m.View.Scale = m.View.W / m.Texture.W
-		}
+	title := fmt.Sprintf("%s - %dx%d", filepath.Base(m.Filename), int(m.Texture.W), int(m.Texture.H))
+	if !m.ColorManagement.Enabled {
+		title += " - unmanaged"
+	} else if m.Texture.Profile != nil && len(m.Texture.Profile.Name) != 0 {
+		title += " - " + m.Texture.Profile.Name
 	}
+	if m.TextureFilter != TextureFilterAuto {
+		title += " - " + m.TextureFilter.String()
+	}
+	if m.DisplayMode != DisplayNormal {
+		title += " - " + m.DisplayMode.String()
+	}
+	if m.Settings.FitMode != FitShrink {
+		title += " - " + m.Settings.FitMode.String()
+	}
+	if m.LockView {
+		title += " - locked"
+	}
+	if !m.Adjustments.IsDefault() {
+		title += " - adjusted"
+	}
+	if !m.ToneMapping.IsDefault() {
+		title += " - " + m.ToneMapping.String()
+	}
+	if m.Compare != nil {
+		title += " - " + m.Compare.String()
+	}
+	m.Window.SetTitle(title)
 }
 
 func (m *Main) LoadFile() error {
 	var err error
 
+	m.rememberView()
+	locked := m.LockView && m.Texture != nil
+
 	m.Filename = m.FileCursor.GetFilename()
 
 	if len(m.Filename) == 0 {
 		return nil
 	}
-	fmt.Printf("loading file %s\n", m.Filename)
+	log.Printf("loading file %s", m.Filename)
 
 	if m.Texture != nil {
 		m.Texture.Destroy()
 	}
 
-	orientation, err := ReadExifOrientation(m.Filename)
+	m.Texture, err = m.openTexture(m.Filename)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %s", err)
 	}
 
-	m.Texture, err = NewTextureFromFile(m.Filename, orientation)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %s", err)
+	m.computeHistogram(m.Texture)
+
+	if !m.Settings.StickyAdjustments {
+		m.Adjustments = DefaultAdjustments
 	}
 
-	m.Window.SetTitle(fmt.Sprintf("%s - %dx%d", filepath.Base(m.Filename), int(m.Texture.W), int(m.Texture.H)))
+	if m.Compare != nil && m.Compare.Source == CompareDirectory {
+		m.loadReference()
+	}
 
-	m.View.X = m.View.W / 2
-	m.View.Y = m.View.H / 2
-	m.View.Scale = 1
+	m.UpdateWindowTitle()
 
-	m.FitToWindow()
+	m.restoreView(locked)
 
 	return nil
 }
+
+// openTexture loads a file with its orientation and color profile
+func (m *Main) openTexture(filename string) (*Texture, error) {
+	orientation, err := ReadExifOrientation(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTextureFromFile(m.Renderer, filename, orientation, m.RequestRedraw)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Profile, err = ReadColorProfile(filename)
+	if err != nil {
+		log.Printf("ignoring embedded color profile: %s", err)
+	}
+	return t, nil
+}
@@ -7,6 +7,8 @@ type Mouse struct {
 
 	DragLeft  MouseDrag
 	DragRight MouseDrag
+	// Navigating is set while the left button is held on the navigator
+	Navigating bool
 }
 
 type MouseDrag struct {
@@ -0,0 +1,111 @@
+package view
+
+import "math"
+
+var (
+	NavigatorBackgroundColor = NewColor(0, 0, 0, 0.6)
+	NavigatorBorderColor     = NewColor(0.4, 0.4, 0.4, 0.8)
+	NavigatorRegionColor     = NewColor(1, 0.8, 0.2, 0.9)
+)
+
+const (
+	// NavigatorMargin is the distance between the navigator and the corner of
+	// the window
+	NavigatorMargin = 16
+	// NavigatorPadding is the space around the thumbnail
+	NavigatorPadding = 4
+)
+
+type NavigatorSettings struct {
+	Enabled bool
+	// Size is the length of the longest side of the thumbnail
+	Size float64
+}
+
+// navigatorTexture returns the image shown in the navigator, the one in the
+// left pane
+func (m *Main) navigatorTexture() *Texture {
+	return m.panes()[0].texture
+}
+
+// navigator returns the placement of the thumbnail in the bottom right corner
+// of the window, it is only shown when the image does not fit in the window.
+func (m *Main) navigator() (view View, box Rect, ok bool) {
+	texture := m.navigatorTexture()
+	if !m.Settings.Navigator.Enabled || texture == nil {
+		return View{}, Rect{}, false
+	}
+
+	w, h := m.View.RotatedSize(texture.W, texture.H)
+	if w*m.View.Scale <= m.View.W+1 && h*m.View.Scale <= m.View.H+1 {
+		return View{}, Rect{}, false
+	}
+
+	scale := m.Settings.Navigator.Size / math.Max(w, h)
+	box = NewRect(
+		m.View.W-NavigatorMargin-w*scale,
+		m.View.H-NavigatorMargin-h*scale,
+		w*scale,
+		h*scale,
+	)
+
+	view = m.View
+	view.X = box.X + box.W/2
+	view.Y = box.Y + box.H/2
+	view.Scale = scale
+	return view, box, true
+}
+
+// DrawNavigator draws the thumbnail of the image with the visible region
+func (m *Main) DrawNavigator(options ImageOptions) {
+	view, box, ok := m.navigator()
+	if !ok {
+		return
+	}
+
+	background := NewRect(box.X-NavigatorPadding, box.Y-NavigatorPadding, box.W+2*NavigatorPadding, box.H+2*NavigatorPadding)
+	DrawQuadBorder(m.Renderer, background, NavigatorBackgroundColor, 1, NavigatorBorderColor)
+
+	options.Sampling = SamplingLinear
+	m.Renderer.SetTransform(view.Transform())
+	m.navigatorTexture().DrawScale(m.Renderer, view.X, view.Y, view.Scale, options)
+	m.Renderer.SetTransform(IdentityTransform)
+
+	// the window in thumbnail coordinates, limited to the thumbnail
+	ratio := view.Scale / m.View.Scale
+	left := math.Max(box.X, view.X-m.View.X*ratio)
+	top := math.Max(box.Y, view.Y-m.View.Y*ratio)
+	right := math.Min(box.X2(), view.X+(m.View.W-m.View.X)*ratio)
+	bottom := math.Min(box.Y2(), view.Y+(m.View.H-m.View.Y)*ratio)
+	if right <= left || bottom <= top {
+		return
+	}
+	DrawQuadOutline(m.Renderer, NewRect(left, top, right-left, bottom-top), 1, NavigatorRegionColor)
+}
+
+// NavigatorContains reports whether the window position x, y is on the
+// navigator, which is only drawn in the left pane when comparing
+func (m *Main) NavigatorContains(x, y float64) bool {
+	if m.Compare != nil && m.mouseRightPane {
+		return false
+	}
+	_, box, ok := m.navigator()
+	return ok && x >= box.X && x < box.X2() && y >= box.Y && y < box.Y2()
+}
+
+// NavigateTo centers the window on the part of the image at the window
+// position x, y in the navigator
+func (m *Main) NavigateTo(x, y float64) {
+	view, box, ok := m.navigator()
+	if !ok {
+		return
+	}
+
+	x = math.Max(box.X, math.Min(box.X2(), x))
+	y = math.Max(box.Y, math.Min(box.Y2(), y))
+
+	m.StopViewAnimations()
+	ratio := m.View.Scale / view.Scale
+	m.View.X = m.View.W/2 - (x-view.X)*ratio
+	m.View.Y = m.View.H/2 - (y-view.Y)*ratio
+}
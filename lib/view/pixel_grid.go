@@ -0,0 +1,42 @@
+package view
+
+import "math"
+
+type PixelGridSettings struct {
+	Enabled bool
+	// Threshold is the scale above which the grid is drawn
+	Threshold float64
+	Color     Color
+}
+
+// DrawPixelGrid draws lines on the source pixel boundaries of the texture,
+// limited to the part of the image that falls within clip. Both are in the
+// untransformed coordinates of the view.
+func DrawPixelGrid(r Renderer, texture *Texture, view View, clip Rect, color Color) {
+	bounds := texture.Bounds(view.X, view.Y, view.Scale)
+	left, top := bounds.X, bounds.Y
+
+	visible := NewRect(
+		math.Max(bounds.X, clip.X),
+		math.Max(bounds.Y, clip.Y),
+		math.Min(bounds.X2(), clip.X2())-math.Max(bounds.X, clip.X),
+		math.Min(bounds.Y2(), clip.Y2())-math.Max(bounds.Y, clip.Y),
+	)
+	if visible.W <= 0 || visible.H <= 0 {
+		return
+	}
+
+	firstColumn := math.Ceil((visible.X - left) / view.Scale)
+	lastColumn := math.Floor((visible.X2() - left) / view.Scale)
+	for column := firstColumn; column <= lastColumn; column++ {
+		x := math.Floor(left + column*view.Scale)
+		r.DrawQuad(NewRect(x, visible.Y, 1, visible.H), color)
+	}
+
+	firstRow := math.Ceil((visible.Y - top) / view.Scale)
+	lastRow := math.Floor((visible.Y2() - top) / view.Scale)
+	for row := firstRow; row <= lastRow; row++ {
+		y := math.Floor(top + row*view.Scale)
+		r.DrawQuad(NewRect(visible.X, y, visible.W, 1), color)
+	}
+}
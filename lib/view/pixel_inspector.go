@@ -0,0 +1,217 @@
+package view
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var (
+	InspectorBackgroundColor = NewColor(0, 0, 0, 0.7)
+	InspectorTextColor       = NewColor(1, 1, 1, 1)
+)
+
+// InspectorPadding is the space around the text of the pixel inspector
+const InspectorPadding = 8
+
+// PixelValue is the color of a source pixel. Channels are 0..1, float images
+// may exceed that range.
+type PixelValue struct {
+	R, G, B, A float64
+	// Float is set for pixels of float images, Linear when they are linear
+	// light
+	Float  bool
+	Linear bool
+}
+
+// SRGB returns the color as 8-bit sRGB values
+func (v PixelValue) SRGB() color.NRGBA {
+	channel := func(c float64) uint8 {
+		c = min(max(c, 0), 1)
+		if v.Linear {
+			c = linearToSrgb(c)
+		}
+		return toByte(c)
+	}
+	return color.NRGBA{R: channel(v.R), G: channel(v.G), B: channel(v.B), A: toByte(min(max(v.A, 0), 1))}
+}
+
+// Hex returns the color as #rrggbb, with the alpha appended when it is not
+// opaque
+func (v PixelValue) Hex() string {
+	c := v.SRGB()
+	if c.A != 0xff {
+		return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// HSL returns the hue in degrees, saturation and lightness of the sRGB color
+func (v PixelValue) HSL() (h, s, l float64) {
+	c := v.SRGB()
+	r, g, b := float64(c.R)/0xff, float64(c.G)/0xff, float64(c.B)/0xff
+
+	high := math.Max(r, math.Max(g, b))
+	low := math.Min(r, math.Min(g, b))
+	l = (high + low) / 2
+	if high == low {
+		return 0, 0, l
+	}
+
+	d := high - low
+	s = d / (1 - math.Abs(2*l-1))
+	switch high {
+	case r:
+		h = math.Mod((g-b)/d+6, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// Lines returns the value as the lines shown by the inspector
+func (v PixelValue) Lines() []string {
+	var rgba string
+	if v.Float {
+		rgba = fmt.Sprintf("rgba %.4f %.4f %.4f %.4f", v.R, v.G, v.B, v.A)
+	} else {
+		c := v.SRGB()
+		rgba = fmt.Sprintf("rgba %d %d %d %d", c.R, c.G, c.B, c.A)
+	}
+	h, s, l := v.HSL()
+	return []string{
+		rgba,
+		v.Hex(),
+		fmt.Sprintf("hsl(%.0f, %.0f%%, %.0f%%)", h, s*100, l*100),
+	}
+}
+
+// Pixel returns the value of the pixel at x, y of the displayed image, read
+// back from the renderer. It is not available for parts of pyramids that are
+// not loaded.
+func (t *Texture) Pixel(r Renderer, x, y int) (PixelValue, bool) {
+	if x < 0 || y < 0 || x >= int(t.W) || y >= int(t.H) {
+		return PixelValue{}, false
+	}
+
+	if t.pyramid != nil {
+		c, ok := t.pyramid.pixel(x, y)
+		if !ok {
+			return PixelValue{}, false
+		}
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		return PixelValue{
+			R: float64(n.R) / 0xff,
+			G: float64(n.G) / 0xff,
+			B: float64(n.B) / 0xff,
+			A: float64(n.A) / 0xff,
+		}, true
+	}
+
+	for _, tile := range t.Tiles {
+		tileX, tileY := x-int(tile.Rect.X), y-int(tile.Rect.Y)
+		if tileX < 0 || tileY < 0 || tileX >= int(tile.Rect.W) || tileY >= int(tile.Rect.H) {
+			continue
+		}
+		c := r.ReadPixel(tile.Image, tileX+int(tile.Source.X), tileY+int(tile.Source.Y))
+		return PixelValue{
+			R:      c[0],
+			G:      c[1],
+			B:      c[2],
+			A:      c[3],
+			Float:  t.Float,
+			Linear: t.Linear,
+		}, true
+	}
+	return PixelValue{}, false
+}
+
+// sourcePoint maps a pixel of the oriented image of w by h pixels back to the
+// pixel in the file
+func (o Orientation) sourcePoint(x, y, w, h int) (int, int) {
+	for n := 0; n < o.numRotations; n++ {
+		// undo a clockwise quarter turn, after which w is the height
+		x, y = y, w-1-x
+		w, h = h, w
+	}
+	if o.mirrored {
+		x = w - 1 - x
+	}
+	return x, y
+}
+
+// imagePixel returns the pixel of texture t under the position x, y in the
+// pane
+func (m *Main) imagePixel(t *Texture, x, y float64) (int, int, bool) {
+	if t == nil {
+		return 0, 0, false
+	}
+
+	localX, localY := m.View.Transform().Invert().Apply(x, y)
+	bounds := t.Bounds(m.View.X, m.View.Y, m.View.Scale)
+	px := int(math.Floor((localX - bounds.X) / m.View.Scale))
+	py := int(math.Floor((localY - bounds.Y) / m.View.Scale))
+	if px < 0 || py < 0 || px >= int(t.W) || py >= int(t.H) {
+		return 0, 0, false
+	}
+	return px, py, true
+}
+
+// DrawInspector shows the file coordinates and value of the pixel under the
+// mouse cursor in the bottom left corner of the pane the mouse is over
+func (m *Main) DrawInspector() {
+	if !m.Inspector {
+		return
+	}
+
+	t := m.mouseTexture()
+	x, y, ok := m.imagePixel(t, m.Mouse.X, m.Mouse.Y)
+	if !ok {
+		return
+	}
+
+	fileX, fileY := t.Orientation.sourcePoint(x, y, int(t.W), int(t.H))
+	lines := []string{fmt.Sprintf("x %d y %d", fileX, fileY)}
+	if value, ok := t.Pixel(m.Renderer, x, y); ok {
+		lines = append(lines, value.Lines()...)
+	} else {
+		lines = append(lines, "not loaded")
+	}
+
+	var w float64
+	for _, line := range lines {
+		lineW, _ := TextSize(line)
+		w = math.Max(w, lineW)
+	}
+	h := float64(len(lines))*LineHeight() - (LineHeight() - fontGlyphH*TextScale)
+
+	rect := NewRect(m.mousePaneOffset()+InspectorPadding, m.View.H-h-3*InspectorPadding, w+2*InspectorPadding, h+2*InspectorPadding)
+	m.Renderer.DrawQuad(rect, InspectorBackgroundColor)
+	for i, line := range lines {
+		m.Renderer.DrawText(line, rect.X+InspectorPadding, rect.Y+InspectorPadding+float64(i)*LineHeight(), InspectorTextColor)
+	}
+}
+
+// CopyPixel puts the hex value of the pixel under the mouse cursor in the
+// clipboard
+func (m *Main) CopyPixel() {
+	t := m.mouseTexture()
+	x, y, ok := m.imagePixel(t, m.Mouse.X, m.Mouse.Y)
+	if !ok {
+		return
+	}
+	value, ok := t.Pixel(m.Renderer, x, y)
+	if !ok {
+		return
+	}
+
+	err := sdl.SetClipboardText(value.Hex())
+	if err != nil {
+		log.Printf("failed to copy pixel value: %s", err)
+	}
+}
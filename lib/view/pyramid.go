@@ -0,0 +1,398 @@
+package view
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	pyramidWorkers  = 4
+	pyramidMaxTiles = 512
+
+	pyramidPlaceholderTiles = 16
+)
+
+// PyramidSource provides the tiles of a multi resolution image. Level 0 is the
+// full resolution image, every following level is smaller.
+type PyramidSource interface {
+	Levels() []PyramidLevel
+	// LoadTile decodes a tile, returning the pixels and the area they cover
+	// in level pixels. It is called from background goroutines.
+	LoadTile(level, column, row int) (*image.NRGBA, Rect, error)
+	Close() error
+}
+
+// OpenPyramidSource opens DeepZoom images and tiled TIFF files as pyramid, it
+// returns nil for any other file.
+func OpenPyramidSource(filename string) (PyramidSource, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".dzi":
+		return NewDeepZoomSource(filename)
+	case ".tif", ".tiff":
+		source, err := NewTIFFPyramidSource(filename)
+		if err != nil {
+			// not tiled, loaded as a regular image
+			return nil, nil
+		}
+		return source, nil
+	}
+	return nil, nil
+}
+
+type PyramidLevel struct {
+	W, H         int
+	TileW, TileH int
+}
+
+func (l PyramidLevel) Columns() int {
+	return (l.W + l.TileW - 1) / l.TileW
+}
+
+func (l PyramidLevel) Rows() int {
+	return (l.H + l.TileH - 1) / l.TileH
+}
+
+type pyramidTileKey struct {
+	level, column, row int
+}
+
+type pyramidTile struct {
+	TextureTile
+	// pixels are kept to read back values
+	pixels   *image.NRGBA
+	level    int
+	lastUsed int
+}
+
+type pyramidTileResult struct {
+	key   pyramidTileKey
+	image *image.NRGBA
+	rect  Rect
+	err   error
+}
+
+// pyramid streams the tiles needed for the current view in the background
+// and keeps a limited number of them uploaded. The smallest level is never
+// evicted when it is small enough, so there is always a placeholder to draw.
+type pyramid struct {
+	source PyramidSource
+	levels []PyramidLevel
+	notify func()
+
+	tiles map[pyramidTileKey]*pyramidTile
+	frame int
+	// wanted collects the missing tiles of every draw in the frame, they
+	// replace the queue when the frame ends
+	wanted []pyramidTileKey
+
+	workers sync.WaitGroup
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []pyramidTileKey
+	loading map[pyramidTileKey]bool
+	loaded  []pyramidTileResult
+	closed  bool
+}
+
+// NewTextureFromPyramid creates a texture which loads the tiles of source on
+// demand. notify is called from a background goroutine whenever a tile is
+// ready to be drawn.
+func NewTextureFromPyramid(source PyramidSource, notify func()) *Texture {
+	p := newPyramid(source, notify)
+	p.workers.Add(pyramidWorkers)
+	for i := 0; i < pyramidWorkers; i++ {
+		go p.work()
+	}
+
+	return &Texture{
+		W:       float64(p.levels[0].W),
+		H:       float64(p.levels[0].H),
+		pyramid: p,
+	}
+}
+
+// newPyramid returns a pyramid without workers to load its queue
+func newPyramid(source PyramidSource, notify func()) *pyramid {
+	p := &pyramid{
+		source:  source,
+		levels:  source.Levels(),
+		notify:  notify,
+		tiles:   map[pyramidTileKey]*pyramidTile{},
+		loading: map[pyramidTileKey]bool{},
+	}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+func (p *pyramid) work() {
+	defer p.workers.Done()
+
+	for {
+		p.mutex.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mutex.Unlock()
+			return
+		}
+		key := p.queue[0]
+		p.queue = p.queue[1:]
+		p.loading[key] = true
+		p.mutex.Unlock()
+
+		i, rect, err := p.source.LoadTile(key.level, key.column, key.row)
+
+		p.mutex.Lock()
+		delete(p.loading, key)
+		if p.closed {
+			p.mutex.Unlock()
+			return
+		}
+		p.loaded = append(p.loaded, pyramidTileResult{key: key, image: i, rect: rect, err: err})
+		p.mutex.Unlock()
+
+		p.notify()
+	}
+}
+
+// level returns the smallest level with at least as many pixels as the screen
+func (p *pyramid) level(scale float64) int {
+	for i := len(p.levels) - 1; i > 0; i-- {
+		if float64(p.levels[i].W)/float64(p.levels[0].W) >= scale {
+			return i
+		}
+	}
+	return 0
+}
+
+func (p *pyramid) upload(r Renderer) {
+	p.mutex.Lock()
+	loaded := p.loaded
+	p.loaded = nil
+	p.mutex.Unlock()
+
+	for _, result := range loaded {
+		if result.err != nil {
+			log.Printf("failed to load tile %v: %s", result.key, result.err)
+			// keep an empty tile so it is not requested again
+			p.tiles[result.key] = &pyramidTile{level: result.key.level, lastUsed: p.frame}
+			continue
+		}
+
+		// convert from level pixels to image pixels
+		level := p.levels[result.key.level]
+		scaleX := float64(p.levels[0].W) / float64(level.W)
+		scaleY := float64(p.levels[0].H) / float64(level.H)
+
+		p.tiles[result.key] = &pyramidTile{
+			TextureTile: TextureTile{
+				Image:  r.NewImage(result.image, result.image.Rect),
+				Rect:   NewRect(result.rect.X*scaleX, result.rect.Y*scaleY, result.rect.W*scaleX, result.rect.H*scaleY),
+				Source: NewRect(0, 0, float64(result.image.Rect.Dx()), float64(result.image.Rect.Dy())),
+			},
+			pixels:   result.image,
+			level:    result.key.level,
+			lastUsed: p.frame,
+		}
+	}
+}
+
+// request appends the tiles of a level which cover the visible area of the
+// image, given in image pixels, and are not loaded yet to queue.
+func (p *pyramid) request(levelIndex int, visible Rect, queue []pyramidTileKey) []pyramidTileKey {
+	imageRect := NewRect(0, 0, float64(p.levels[0].W), float64(p.levels[0].H))
+	if !visible.Intersects(imageRect) {
+		return queue
+	}
+
+	level := p.levels[levelIndex]
+	scaleX := float64(level.W) / float64(p.levels[0].W)
+	scaleY := float64(level.H) / float64(p.levels[0].H)
+
+	firstColumn := max(int(visible.X*scaleX)/level.TileW, 0)
+	lastColumn := min(int(math.Ceil(visible.X2()*scaleX))/level.TileW, level.Columns()-1)
+	firstRow := max(int(visible.Y*scaleY)/level.TileH, 0)
+	lastRow := min(int(math.Ceil(visible.Y2()*scaleY))/level.TileH, level.Rows()-1)
+
+	var missing []pyramidTileKey
+	for row := firstRow; row <= lastRow; row++ {
+		for column := firstColumn; column <= lastColumn; column++ {
+			key := pyramidTileKey{level: levelIndex, column: column, row: row}
+			if tile, ok := p.tiles[key]; ok {
+				tile.lastUsed = p.frame
+				continue
+			}
+			missing = append(missing, key)
+		}
+	}
+
+	// load the tiles in the center of the view first
+	centerColumn := float64(firstColumn+lastColumn) / 2
+	centerRow := float64(firstRow+lastRow) / 2
+	distance := func(key pyramidTileKey) float64 {
+		return math.Hypot(float64(key.column)-centerColumn, float64(key.row)-centerRow)
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return distance(missing[i]) < distance(missing[j])
+	})
+
+	return append(queue, missing...)
+}
+
+// beginFrame uploads the tiles loaded since the last frame and starts
+// collecting the tiles wanted by the draws of this one
+func (p *pyramid) beginFrame(r Renderer) {
+	p.frame++
+	p.upload(r)
+	p.wanted = p.wanted[:0]
+}
+
+// endFrame replaces the queue with the tiles wanted in the frame, those of
+// the first draw first, and evicts tiles that were not used
+func (p *pyramid) endFrame() {
+	queued := map[pyramidTileKey]bool{}
+
+	p.mutex.Lock()
+	p.queue = p.queue[:0]
+	for _, key := range p.wanted {
+		if !p.loading[key] && !queued[key] {
+			p.queue = append(p.queue, key)
+			queued[key] = true
+		}
+	}
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+
+	p.evict()
+}
+
+// draw draws the loaded tiles covering clip and requests the missing ones.
+// It may be called several times between beginFrame and endFrame, for
+// example for the navigator and the loupe.
+func (p *pyramid) draw(r Renderer, t *Texture, bounds Rect, scale float64, clip Rect, options ImageOptions) {
+	visible := NewRect(
+		(clip.X-bounds.X)/scale,
+		(clip.Y-bounds.Y)/scale,
+		clip.W/scale,
+		clip.H/scale,
+	)
+
+	target := p.level(scale)
+	if p.isPlaceholder(len(p.levels) - 1) {
+		p.wanted = p.request(len(p.levels)-1, NewRect(0, 0, t.W, t.H), p.wanted)
+	}
+	if !p.isPlaceholder(target) {
+		p.wanted = p.request(target, visible, p.wanted)
+	}
+
+	// draw coarse tiles first, finer tiles cover them once they are loaded
+	var drawn []*pyramidTile
+	for _, tile := range p.tiles {
+		if tile.Image == nil || tile.level < target {
+			continue
+		}
+		rect := tile.screenRect(bounds, scale)
+		if rect.Intersects(clip) {
+			drawn = append(drawn, tile)
+		}
+	}
+	sort.Slice(drawn, func(i, j int) bool {
+		return drawn[i].level > drawn[j].level
+	})
+	for _, tile := range drawn {
+		r.DrawImage(tile.Image, tile.Source, tile.screenRect(bounds, scale), options)
+	}
+}
+
+// pixel returns the pixel at x, y in image pixels from the finest loaded level
+// covering it
+func (p *pyramid) pixel(x, y int) (color.Color, bool) {
+	for index, level := range p.levels {
+		levelX := x * level.W / p.levels[0].W
+		levelY := y * level.H / p.levels[0].H
+		tile, ok := p.tiles[pyramidTileKey{index, levelX / level.TileW, levelY / level.TileH}]
+		if !ok || tile.pixels == nil {
+			continue
+		}
+
+		// tiles may overlap their neighbours, the rect is in image pixels
+		scale := float64(level.W) / float64(p.levels[0].W)
+		tileX := levelX - int(math.Round(tile.Rect.X*scale))
+		tileY := levelY - int(math.Round(tile.Rect.Y*scale))
+		bounds := tile.pixels.Rect
+		return tile.pixels.At(bounds.Min.X+tileX, bounds.Min.Y+tileY), true
+	}
+	return nil, false
+}
+
+// isPlaceholder reports whether a level is the smallest one and small enough
+// to keep it loaded completely.
+func (p *pyramid) isPlaceholder(level int) bool {
+	l := p.levels[level]
+	return level == len(p.levels)-1 && l.Columns()*l.Rows() <= pyramidPlaceholderTiles
+}
+
+func (p *pyramid) evict() {
+	if len(p.tiles) <= pyramidMaxTiles {
+		return
+	}
+
+	var candidates []pyramidTileKey
+	for key, tile := range p.tiles {
+		if !p.isPlaceholder(tile.level) && tile.lastUsed != p.frame {
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return p.tiles[candidates[i]].lastUsed < p.tiles[candidates[j]].lastUsed
+	})
+
+	for _, key := range candidates[:min(len(candidates), len(p.tiles)-pyramidMaxTiles)] {
+		tile := p.tiles[key]
+		if tile.Image != nil {
+			tile.Image.Destroy()
+		}
+		delete(p.tiles, key)
+	}
+}
+
+func (p *pyramid) destroy() {
+	p.mutex.Lock()
+	p.closed = true
+	p.queue = nil
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+
+	for _, tile := range p.tiles {
+		if tile.Image != nil {
+			tile.Image.Destroy()
+		}
+	}
+	p.tiles = nil
+
+	// workers may still be decoding, the source is closed once they are done
+	go func() {
+		p.workers.Wait()
+		_ = p.source.Close()
+	}()
+}
+
+// toNRGBA converts a decoded tile to non premultiplied RGBA, as expected by
+// the renderers.
+func toNRGBA(src image.Image) *image.NRGBA {
+	if i, ok := src.(*image.NRGBA); ok {
+		return i
+	}
+	bounds := src.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Rect, src, bounds.Min, draw.Src)
+	return result
+}
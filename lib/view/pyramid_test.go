@@ -0,0 +1,303 @@
+package view
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// testPyramidSource has tiles colored by level, red, green and blue from the
+// full size level down, the smallest level fits in pyramidPlaceholderTiles
+// tiles
+type testPyramidSource struct {
+	levels []PyramidLevel
+}
+
+func newTestPyramidSource() *testPyramidSource {
+	return &testPyramidSource{levels: []PyramidLevel{
+		{W: 1024, H: 1024, TileW: 64, TileH: 64},
+		{W: 512, H: 512, TileW: 64, TileH: 64},
+		{W: 256, H: 256, TileW: 64, TileH: 64},
+	}}
+}
+
+func (s *testPyramidSource) Levels() []PyramidLevel {
+	return s.levels
+}
+
+func (s *testPyramidSource) LoadTile(level, column, row int) (*image.NRGBA, Rect, error) {
+	l := s.levels[level]
+	x, y := column*l.TileW, row*l.TileH
+	w, h := min(l.TileW, l.W-x), min(l.TileH, l.H-y)
+	tile := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(tile, tile.Rect, image.NewUniform(testLevelColors[level]), image.Point{}, draw.Src)
+	return tile, NewRect(float64(x), float64(y), float64(w), float64(h)), nil
+}
+
+var testLevelColors = []color.RGBA{testRed, testGreen, testBlue}
+
+func (s *testPyramidSource) Close() error {
+	return nil
+}
+
+func newTestPyramidTexture() *Texture {
+	source := newTestPyramidSource()
+	return &Texture{
+		W:       float64(source.levels[0].W),
+		H:       float64(source.levels[0].H),
+		pyramid: newPyramid(source, func() {}),
+	}
+}
+
+// loadTestPyramid loads the queued tiles like the workers do
+func loadTestPyramid(p *pyramid) {
+	for _, key := range p.queue {
+		i, rect, err := p.source.LoadTile(key.level, key.column, key.row)
+		p.loaded = append(p.loaded, pyramidTileResult{key: key, image: i, rect: rect, err: err})
+	}
+	p.queue = p.queue[:0]
+}
+
+func queued(p *pyramid, key pyramidTileKey) bool {
+	for _, k := range p.queue {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// the top left corner of the image at full size, and the whole image in a
+// thumbnail
+func drawTestPyramidFrame(r Renderer, t *Texture) {
+	t.BeginFrame(r)
+	t.DrawScaleClipped(r, 512, 512, 1, NewRect(0, 0, 32, 32), ImageOptions{})
+	t.DrawScale(r, 16, 16, 32/t.W, ImageOptions{})
+	t.EndFrame()
+}
+
+func TestPyramidDrawTwiceInFrame(t *testing.T) {
+	r := NewSoftwareRenderer(32, 32)
+	texture := newTestPyramidTexture()
+	p := texture.pyramid
+	corner := pyramidTileKey{level: 0, column: 0, row: 0}
+
+	drawTestPyramidFrame(r, texture)
+	if !queued(p, corner) {
+		t.Fatalf("tile of the first draw is not queued: %v", p.queue)
+	}
+	seen := map[pyramidTileKey]bool{}
+	for _, key := range p.queue {
+		if seen[key] {
+			t.Errorf("tile %v is queued twice", key)
+		}
+		seen[key] = true
+	}
+
+	loadTestPyramid(p)
+	drawTestPyramidFrame(r, texture)
+	tile, ok := p.tiles[corner]
+	if !ok || tile.Image == nil {
+		t.Fatalf("tile of the first draw is not loaded")
+	}
+	if tile.lastUsed != p.frame {
+		t.Errorf("tile of the first draw is not used in the frame")
+	}
+	if len(p.queue) != 0 {
+		t.Errorf("loaded tiles are queued again: %v", p.queue)
+	}
+}
+
+// the loupe requests finer tiles than the main view in the same frame
+func TestPyramidDrawLoupe(t *testing.T) {
+	r := NewSoftwareRenderer(64, 64)
+	texture := newTestPyramidTexture()
+	p := texture.pyramid
+
+	m := &Main{
+		Renderer: r,
+		Settings: DefaultSettings,
+		Texture:  texture,
+		View:     View{X: 32, Y: 32, W: 64, H: 64, Scale: 0.5},
+		windowW:  64,
+		Loupe:    true,
+	}
+	m.Settings.Loupe = LoupeSettings{Factor: 4, Size: 16}
+	m.Mouse.X, m.Mouse.Y = 32, 32
+
+	view := pyramidTileKey{level: 1, column: 3, row: 3}
+	loupe := pyramidTileKey{level: 0, column: 7, row: 7}
+
+	m.Draw()
+	for _, key := range []pyramidTileKey{view, loupe} {
+		if !queued(p, key) {
+			t.Errorf("tile %v is not queued: %v", key, p.queue)
+		}
+	}
+
+	loadTestPyramid(p)
+	m.Draw()
+	for _, key := range []pyramidTileKey{view, loupe} {
+		if tile, ok := p.tiles[key]; !ok || tile.lastUsed != p.frame {
+			t.Errorf("tile %v is not used in the frame", key)
+		}
+	}
+}
+
+func TestPyramidLevel(t *testing.T) {
+	p := newTestPyramidTexture().pyramid
+
+	tests := []struct {
+		scale    float64
+		expected int
+	}{
+		{2, 0},
+		{1, 0},
+		{0.75, 0},
+		{0.5, 1},
+		{0.3, 1},
+		{0.25, 2},
+		{0.1, 2},
+	}
+	for _, test := range tests {
+		if level := p.level(test.scale); level != test.expected {
+			t.Errorf("level at scale %g is %d, expected %d", test.scale, level, test.expected)
+		}
+	}
+}
+
+func TestPyramidIsPlaceholder(t *testing.T) {
+	p := newTestPyramidTexture().pyramid
+	if p.isPlaceholder(1) {
+		t.Errorf("level 1 is a placeholder")
+	}
+	if !p.isPlaceholder(2) {
+		t.Errorf("smallest level is not a placeholder")
+	}
+
+	// smallest level with more tiles than pyramidPlaceholderTiles
+	source := &testPyramidSource{levels: []PyramidLevel{
+		{W: 1024, H: 1024, TileW: 64, TileH: 64},
+		{W: 512, H: 512, TileW: 64, TileH: 64},
+	}}
+	if newPyramid(source, func() {}).isPlaceholder(1) {
+		t.Errorf("level with 64 tiles is a placeholder")
+	}
+}
+
+// the placeholder is drawn until the tiles of the view are loaded
+func TestPyramidPlaceholder(t *testing.T) {
+	r := NewSoftwareRenderer(32, 32)
+	texture := newTestPyramidTexture()
+	p := texture.pyramid
+
+	drawFrame := func() {
+		texture.BeginFrame(r)
+		texture.DrawScaleClipped(r, 512, 512, 1, NewRect(0, 0, 32, 32), ImageOptions{})
+		texture.EndFrame()
+	}
+
+	drawFrame()
+	if len(p.queue) != 17 {
+		t.Fatalf("expected 16 placeholder tiles and one view tile queued, got %v", p.queue)
+	}
+	for _, key := range p.queue[:16] {
+		if key.level != 2 {
+			t.Errorf("tile %v is queued before the placeholder", key)
+		}
+	}
+	checkPixels(t, r.Image, []testPixel{{0, 0, testEmpty}})
+
+	// only the placeholder is loaded
+	p.queue = p.queue[:16]
+	loadTestPyramid(p)
+	drawFrame()
+	checkPixels(t, r.Image, []testPixel{{0, 0, testBlue}})
+	if len(p.queue) != 1 || p.queue[0] != (pyramidTileKey{0, 0, 0}) {
+		t.Errorf("expected the view tile queued, got %v", p.queue)
+	}
+
+	loadTestPyramid(p)
+	drawFrame()
+	checkPixels(t, r.Image, []testPixel{{0, 0, testRed}})
+}
+
+func TestPyramidQueueReplaced(t *testing.T) {
+	r := NewSoftwareRenderer(32, 32)
+	texture := newTestPyramidTexture()
+	p := texture.pyramid
+
+	drawCorner := func(x, y float64) {
+		texture.BeginFrame(r)
+		texture.DrawScaleClipped(r, x, y, 1, NewRect(0, 0, 32, 32), ImageOptions{})
+		texture.EndFrame()
+	}
+
+	topLeft := pyramidTileKey{0, 0, 0}
+	bottomRight := pyramidTileKey{0, 15, 15}
+
+	drawCorner(512, 512)
+	if !queued(p, topLeft) {
+		t.Fatalf("top left tile is not queued: %v", p.queue)
+	}
+
+	// the view moved to the bottom right before the tile was loaded
+	drawCorner(-480, -480)
+	if queued(p, topLeft) {
+		t.Errorf("tile that is no longer visible is still queued")
+	}
+	if !queued(p, bottomRight) {
+		t.Errorf("bottom right tile is not queued: %v", p.queue)
+	}
+
+	// tiles being loaded are not queued again
+	p.loading[bottomRight] = true
+	drawCorner(-480, -480)
+	if queued(p, bottomRight) {
+		t.Errorf("tile that is being loaded is queued again")
+	}
+}
+
+func TestPyramidEvict(t *testing.T) {
+	r := NewSoftwareRenderer(1, 1)
+	p := newTestPyramidTexture().pyramid
+	p.frame = pyramidMaxTiles
+
+	// the placeholder and more full size tiles than fit, the oldest first
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			p.tiles[pyramidTileKey{2, column, row}] = &pyramidTile{level: 2}
+		}
+	}
+	for i := 0; i < pyramidMaxTiles; i++ {
+		key := pyramidTileKey{0, i % 16, i / 16}
+		p.tiles[key] = &pyramidTile{level: 0, lastUsed: i}
+	}
+	used := pyramidTileKey{0, 0, 0}
+	p.tiles[used].lastUsed = p.frame
+	p.tiles[used].Image = r.NewImage(testQuadrants(), image.Rect(0, 0, 2, 2))
+
+	p.evict()
+
+	if len(p.tiles) != pyramidMaxTiles {
+		t.Errorf("%d tiles are kept, expected %d", len(p.tiles), pyramidMaxTiles)
+	}
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			if _, ok := p.tiles[pyramidTileKey{2, column, row}]; !ok {
+				t.Errorf("placeholder tile %d, %d is evicted", column, row)
+			}
+		}
+	}
+	if _, ok := p.tiles[used]; !ok {
+		t.Errorf("tile used in the frame is evicted")
+	}
+	// the oldest tiles go first
+	if _, ok := p.tiles[pyramidTileKey{0, 1, 0}]; ok {
+		t.Errorf("oldest tile is kept")
+	}
+	if _, ok := p.tiles[pyramidTileKey{0, 15, 31}]; !ok {
+		t.Errorf("newest tile is evicted")
+	}
+}
@@ -0,0 +1,127 @@
+package view
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Renderer draws the view. GLRenderer draws to the window, SoftwareRenderer
+// draws into an image.RGBA so frames can be rendered without a display.
+// Coordinates are window pixels with the origin in the top left corner.
+type Renderer interface {
+	SetViewport(w, h float64)
+	// MaxImageSize is the largest width and height accepted by NewImage,
+	// larger images are split into tiles by the texture
+	MaxImageSize() int
+	// NewImage copies the rect area of pixels, either an *image.NRGBA or a
+	// *FloatImage, so the caller is free to release them afterwards.
+	NewImage(pixels image.Image, rect image.Rectangle) RendererImage
+	// ReadPixel returns the channels of the pixel at x, y of an image as they
+	// are stored by the renderer
+	ReadPixel(i RendererImage, x, y int) [4]float64
+
+	Clear(color Color)
+	// SetTransform applies a transformation to everything drawn afterwards
+	SetTransform(t Transform)
+	// SetClip limits everything drawn afterwards to an area of the window,
+	// the zero Clip draws everywhere
+	SetClip(clip Clip)
+	// DrawImage draws the source area of an image, in image pixels, to rect
+	DrawImage(i RendererImage, source, rect Rect, options ImageOptions)
+	DrawQuad(rect Rect, color Color)
+	// DrawCheckerboard fills rect with squares of size alternating between
+	// light and dark, the first light square starting at x, y
+	DrawCheckerboard(rect Rect, x, y, size float64, light, dark Color)
+	// DrawText draws a single line with the built-in bitmap font, x and y
+	// being the top left corner of the text
+	DrawText(text string, x, y float64, color Color)
+	// Present shows the frame that was drawn since the last call
+	Present()
+
+	Destroy()
+}
+
+// RendererImage is image data owned by a renderer.
+type RendererImage interface {
+	Destroy()
+}
+
+// ImageOptions describe how the pixels of an image are turned into display
+// values, the same for every renderer.
+type ImageOptions struct {
+	Sampling Sampling
+	// Linear is set for images holding linear light instead of sRGB values
+	Linear bool
+	// Profile is the color profile of the image, nil for sRGB
+	Profile *ColorProfile
+
+	ToneMapping     ToneMapping
+	ColorManagement ColorManagement
+	DisplayMode     DisplayMode
+	Adjustments     Adjustments
+}
+
+// Clip is an area of the window, in window coordinates
+type Clip struct {
+	Shape ClipShape
+	Rect  Rect
+}
+
+type ClipShape int
+
+const (
+	ClipNone ClipShape = iota
+	ClipRect
+	// ClipEllipse is the ellipse filling Rect
+	ClipEllipse
+)
+
+// Contains reports whether the window position x, y lies within the clip
+func (c Clip) Contains(x, y float64) bool {
+	switch c.Shape {
+	case ClipRect:
+		return x >= c.Rect.X && x < c.Rect.X2() && y >= c.Rect.Y && y < c.Rect.Y2()
+	case ClipEllipse:
+		dx := (x - c.Rect.X - c.Rect.W/2) / (c.Rect.W / 2)
+		dy := (y - c.Rect.Y - c.Rect.H/2) / (c.Rect.H / 2)
+		return dx*dx+dy*dy <= 1
+	}
+	return true
+}
+
+type Sampling int
+
+const (
+	// SamplingLinear interpolates magnified pixels and trilinearly filters
+	// minified images
+	SamplingLinear Sampling = iota
+	// SamplingNearestMagnified keeps magnified pixels sharp, minified images
+	// are still filtered
+	SamplingNearestMagnified
+	// SamplingNearest never interpolates
+	SamplingNearest
+	samplingCount
+)
+
+var samplingNames = map[Sampling]string{
+	SamplingLinear:           "linear",
+	SamplingNearestMagnified: "nearest magnified",
+	SamplingNearest:          "nearest",
+}
+
+func (s Sampling) String() string {
+	name, ok := samplingNames[s]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+	return name
+}
+
+// convertImage copies the rect area of an image that is neither an
+// *image.NRGBA nor a *FloatImage to an *image.NRGBA.
+func convertImage(pixels image.Image, rect image.Rectangle) *image.NRGBA {
+	result := image.NewNRGBA(rect)
+	draw.Draw(result, rect, pixels, rect.Min, draw.Src)
+	return result
+}
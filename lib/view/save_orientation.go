@@ -0,0 +1,538 @@
+package view
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	exifOrientationTag = 0x0112
+	exifTypeShort      = 3
+
+	// BackupExtension is appended to the name of the copy of a file that is
+	// kept when its orientation is saved
+	BackupExtension = ".orig"
+)
+
+// SaveOrientation stores an orientation, relative to how the file is
+// displayed now, in the file. The exif orientation tag of JPEG files is
+// rewritten without touching the image data, PNG files are rotated
+// losslessly. Other formats are not supported.
+func SaveOrientation(filename string, orientation Orientation) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		current, err := ReadExifOrientation(filename)
+		if err != nil {
+			return err
+		}
+		return writeJPEGOrientation(filename, current.Then(orientation).ExifValue())
+	case ".png":
+		return rotatePNG(filename, orientation)
+	}
+	return fmt.Errorf("saving the orientation of %s files is not supported", filepath.Ext(filename))
+}
+
+// SaveOrientation writes the flips and rotation of the view to the current
+// file and reloads it, after asking for confirmation when configured to.
+func (m *Main) SaveOrientation() error {
+	if len(m.Filename) == 0 {
+		return nil
+	}
+
+	orientation, ok := m.View.Orientation()
+	if !ok {
+		return fmt.Errorf("only rotations by multiples of 90 degrees can be saved")
+	}
+	if orientation == DefaultOrientation {
+		return nil
+	}
+
+	if m.Settings.ConfirmSaveOrientation && !m.confirm("Save orientation", fmt.Sprintf("Save the orientation to %s?", filepath.Base(m.Filename))) {
+		return nil
+	}
+
+	if m.Settings.OrientationBackup {
+		err := BackupFile(m.Filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := SaveOrientation(m.Filename, orientation)
+	if err != nil {
+		return err
+	}
+
+	// the orientation is part of the file now, also when the view is locked
+	// or remembered
+	m.View.ResetTransform()
+	err = m.LoadFile()
+	if err != nil {
+		return err
+	}
+	if !m.LockView {
+		m.Fit(m.Settings.FitMode)
+	}
+	return nil
+}
+
+// confirm shows a message box with ok and cancel buttons and reports whether
+// ok was chosen
+func (m *Main) confirm(title, message string) bool {
+	button, err := sdl.ShowMessageBox(&sdl.MessageBoxData{
+		Flags:   sdl.MESSAGEBOX_WARNING,
+		Window:  m.Window,
+		Title:   title,
+		Message: message,
+		Buttons: []sdl.MessageBoxButtonData{
+			{Flags: sdl.MESSAGEBOX_BUTTON_ESCAPEKEY_DEFAULT, ButtonID: 0, Text: "Cancel"},
+			{Flags: sdl.MESSAGEBOX_BUTTON_RETURNKEY_DEFAULT, ButtonID: 1, Text: "OK"},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to show message box: %s", err)
+		return false
+	}
+	return button == 1
+}
+
+// BackupFile copies a file next to it with BackupExtension appended, unless
+// such a copy exists already, so the first original is kept.
+func BackupFile(filename string) error {
+	backup := filename + BackupExtension
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error while opening file: %s", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0664)
+	if err != nil {
+		return fmt.Errorf("error while creating backup: %s", err)
+	}
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return fmt.Errorf("error while writing backup: %s", err)
+	}
+	return dst.Close()
+}
+
+// writeJPEGOrientation overwrites the orientation tag in the exif data of a
+// JPEG file in place. Files without exif data get a minimal exif segment and
+// exif data without the tag gets it added, only then the file is rewritten.
+func writeJPEGOrientation(filename string, value int) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error while opening file: %s", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("error while reading file: %s", err)
+	}
+
+	location, err := findJPEGOrientation(data)
+	if err != nil {
+		return err
+	}
+
+	if location.offset >= 0 {
+		b := make([]byte, 2)
+		location.order.PutUint16(b, uint16(value))
+		_, err = f.WriteAt(b, int64(location.offset))
+		if err != nil {
+			return fmt.Errorf("error while writing orientation: %s", err)
+		}
+		return nil
+	}
+
+	segment := newExifSegment(value)
+	if location.exif != nil {
+		segment, err = addExifOrientation(location.exif, location.order, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	var result bytes.Buffer
+	result.Write(data[:location.segmentAt])
+	result.Write(segment)
+	result.Write(data[location.segmentAt+len(location.exif):])
+	return replaceFile(filename, result.Bytes())
+}
+
+// jpegOrientation is where the orientation is stored in a JPEG file
+type jpegOrientation struct {
+	// offset is the file offset of the orientation value, or -1 when the
+	// file has no orientation tag
+	offset int
+	order  binary.ByteOrder
+	// exif is the exif segment including its marker, nil when the file has
+	// no exif data
+	exif []byte
+	// segmentAt is where the exif segment starts, or where a new one belongs
+	segmentAt int
+}
+
+// findJPEGOrientation locates the orientation value and the exif segment.
+// A new exif segment belongs after the JFIF segment if there is one.
+func findJPEGOrientation(data []byte) (jpegOrientation, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return jpegOrientation{}, fmt.Errorf("not a jpeg file")
+	}
+
+	location := jpegOrientation{offset: -1, segmentAt: 2}
+	for p := 2; p+4 <= len(data); {
+		if data[p] != 0xff {
+			return jpegOrientation{}, fmt.Errorf("invalid jpeg marker at %d", p)
+		}
+		marker := data[p+1]
+		if marker == 0xda || marker == 0xd9 {
+			// start of scan or end of image, no exif segment
+			break
+		}
+		// the length includes its own two bytes
+		length := int(binary.BigEndian.Uint16(data[p+2:]))
+		if length < 2 || p+2+length > len(data) {
+			return jpegOrientation{}, fmt.Errorf("invalid jpeg segment at %d", p)
+		}
+		segment := data[p+4 : p+2+length]
+
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			offset, order, err := findTIFFOrientation(segment[6:])
+			if err != nil {
+				return jpegOrientation{}, err
+			}
+			location.order = order
+			location.exif = data[p : p+2+length]
+			location.segmentAt = p
+			if offset >= 0 {
+				location.offset = p + 4 + 6 + offset
+			}
+			return location, nil
+		}
+
+		if marker == 0xe0 && p == 2 {
+			location.segmentAt = p + 2 + length
+		}
+		p += 2 + length
+	}
+
+	return location, nil
+}
+
+// findTIFFOrientation returns the offset of the orientation value in the
+// first IFD of tiff structured exif data, or -1 when it has no orientation
+// tag
+func findTIFFOrientation(tiff []byte) (int, binary.ByteOrder, error) {
+	if len(tiff) < 8 {
+		return 0, nil, fmt.Errorf("exif data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, nil, fmt.Errorf("invalid exif byte order")
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, nil, fmt.Errorf("invalid exif ifd offset")
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		if order.Uint16(tiff[entry+2:]) != exifTypeShort || order.Uint32(tiff[entry+4:]) != 1 {
+			return 0, nil, fmt.Errorf("unexpected exif orientation format")
+		}
+		return entry + 8, order, nil
+	}
+
+	return -1, order, nil
+}
+
+// addExifOrientation returns the exif segment with a copy of the first IFD
+// that includes the orientation tag. The copy is appended to the exif data
+// and the old IFD is left unused, so no offsets to other values change.
+func addExifOrientation(segment []byte, order binary.ByteOrder, value int) ([]byte, error) {
+	tiff := segment[4+6:]
+	ifd := int(order.Uint32(tiff[4:]))
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12
+	if end+4 > len(tiff) || count == 0xffff {
+		return nil, fmt.Errorf("invalid exif ifd")
+	}
+
+	orientation := make([]byte, 12)
+	order.PutUint16(orientation[0:], exifOrientationTag)
+	order.PutUint16(orientation[2:], exifTypeShort)
+	order.PutUint32(orientation[4:], 1)
+	order.PutUint16(orientation[8:], uint16(value))
+
+	result := append([]byte{}, segment...)
+	// an IFD starts on a word boundary
+	if len(result[4+6:])%2 == 1 {
+		result = append(result, 0)
+	}
+	newIFD := len(result[4+6:])
+
+	result = append(result, 0, 0)
+	order.PutUint16(result[len(result)-2:], uint16(count+1))
+	// entries are sorted by tag
+	added := false
+	for i := 0; i < count; i++ {
+		entry := tiff[ifd+2+i*12:][:12]
+		if !added && order.Uint16(entry) > exifOrientationTag {
+			result = append(result, orientation...)
+			added = true
+		}
+		result = append(result, entry...)
+	}
+	if !added {
+		result = append(result, orientation...)
+	}
+	// the next IFD, usually the thumbnail
+	result = append(result, tiff[end:end+4]...)
+
+	if len(result)-2 > 0xffff {
+		return nil, fmt.Errorf("exif data too large to add the orientation")
+	}
+	binary.BigEndian.PutUint16(result[2:], uint16(len(result)-2))
+	order.PutUint32(result[4+6+4:], uint32(newIFD))
+	return result, nil
+}
+
+// newExifSegment returns an APP1 segment with only the orientation tag
+func newExifSegment(value int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, // byte order, magic
+		0, 0, 0, 8, // first ifd
+		0, 1, // entry count
+		0x01, 0x12, 0, exifTypeShort, 0, 0, 0, 1, byte(value >> 8), byte(value), 0, 0,
+		0, 0, 0, 0, // no next ifd
+	}
+
+	segment := []byte{0xff, 0xe1, 0, 0}
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// pngKeptChunks are copied to the rotated file, others are either written by
+// the encoder or depend on the encoded pixel format
+var pngKeptChunks = map[string]bool{
+	"iCCP": true,
+	"sRGB": true,
+	"gAMA": true,
+	"cHRM": true,
+	"pHYs": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// rotatePNG decodes a PNG file, applies the orientation to its pixels and
+// encodes it again, keeping the pixel format and color related chunks
+func rotatePNG(filename string, orientation Orientation) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error while reading file: %s", err)
+	}
+
+	i, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error while decoding png: %s", err)
+	}
+
+	var encoded bytes.Buffer
+	err = png.Encode(&encoded, orientImage(i, orientation))
+	if err != nil {
+		return fmt.Errorf("error while encoding png: %s", err)
+	}
+
+	original, err := readPNGChunks(data)
+	if err != nil {
+		return err
+	}
+	rotated, err := readPNGChunks(encoded.Bytes())
+	if err != nil {
+		return err
+	}
+
+	result := bytes.NewBuffer(append([]byte{}, data[:8]...))
+	for _, chunk := range rotated {
+		writePNGChunk(result, chunk)
+		if chunk.Type != "IHDR" {
+			continue
+		}
+		for _, kept := range original {
+			if !pngKeptChunks[kept.Type] {
+				continue
+			}
+			if kept.Type == "pHYs" && orientation.numRotations%2 == 1 && len(kept.Data) == 9 {
+				// swap the horizontal and vertical pixel density
+				swapped := append(append(append([]byte{}, kept.Data[4:8]...), kept.Data[:4]...), kept.Data[8])
+				kept.Data = swapped
+			}
+			writePNGChunk(result, kept)
+		}
+	}
+
+	return replaceFile(filename, result.Bytes())
+}
+
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if len(data) < 8 || string(data[1:4]) != "PNG" {
+		return nil, fmt.Errorf("not a png file")
+	}
+
+	var chunks []pngChunk
+	for p := 8; p+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[p:]))
+		if p+12+length > len(data) {
+			return nil, fmt.Errorf("png chunk exceeds file")
+		}
+		chunks = append(chunks, pngChunk{
+			Type: string(data[p+4 : p+8]),
+			Data: data[p+8 : p+8+length],
+		})
+		p += 12 + length
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w *bytes.Buffer, chunk pngChunk) {
+	_ = binary.Write(w, binary.BigEndian, uint32(len(chunk.Data)))
+	w.WriteString(chunk.Type)
+	w.Write(chunk.Data)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunk.Type))
+	crc.Write(chunk.Data)
+	_ = binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// orientImage mirrors and rotates an image like Orient does for float
+// images, into an image of the same type so no precision is lost.
+func orientImage(src image.Image, orientation Orientation) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := w, h
+	if orientation.numRotations%2 == 1 {
+		dstW, dstH = h, w
+	}
+	dst := newImageLike(src, image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, y
+			if orientation.mirrored {
+				dx = w - 1 - x
+			}
+			// clockwise quarter turns of a cw by ch image
+			cw, ch := w, h
+			for n := 0; n < orientation.numRotations; n++ {
+				dx, dy = ch-1-dy, dx
+				cw, ch = ch, cw
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+type settableImage interface {
+	image.Image
+	Set(x, y int, c color.Color)
+}
+
+// newImageLike returns an empty image of the same type as i, any type that
+// is not produced by the png decoder becomes 16-bit NRGBA.
+func newImageLike(i image.Image, rect image.Rectangle) settableImage {
+	switch src := i.(type) {
+	case *image.Gray:
+		return image.NewGray(rect)
+	case *image.Gray16:
+		return image.NewGray16(rect)
+	case *image.NRGBA:
+		return image.NewNRGBA(rect)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(rect)
+	case *image.RGBA:
+		return image.NewRGBA(rect)
+	case *image.RGBA64:
+		return image.NewRGBA64(rect)
+	case *image.Paletted:
+		return image.NewPaletted(rect, src.Palette)
+	}
+	return image.NewNRGBA64(rect)
+}
+
+// replaceFile writes data to a temporary file next to filename and renames
+// it, so the file is never left half written.
+func replaceFile(filename string, data []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("error while reading file info: %s", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return fmt.Errorf("error while creating temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(info.Mode())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error while writing temporary file: %s", err)
+	}
+
+	err = os.Rename(f.Name(), filename)
+	if err != nil {
+		return fmt.Errorf("error while replacing file: %s", err)
+	}
+	return nil
+}
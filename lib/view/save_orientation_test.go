@@ -0,0 +1,410 @@
+package view
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+type exifEntry struct {
+	tag uint16
+	// short is the value of the entry, unless text is set
+	short uint16
+	text  string
+}
+
+// buildExifSegment returns an APP1 segment with the entries in the first
+// IFD. Text longer than 4 bytes is stored after the IFD.
+func buildExifSegment(order binary.AppendByteOrder, entries ...exifEntry) []byte {
+	var tiff []byte
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	} else {
+		tiff = []byte("II*\x00")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, uint16(len(entries)))
+
+	values := 8 + 2 + len(entries)*12 + 4
+	var data []byte
+	for _, entry := range entries {
+		tiff = order.AppendUint16(tiff, entry.tag)
+		if entry.text == "" {
+			tiff = order.AppendUint16(tiff, exifTypeShort)
+			tiff = order.AppendUint32(tiff, 1)
+			tiff = order.AppendUint16(tiff, entry.short)
+			tiff = append(tiff, 0, 0)
+			continue
+		}
+
+		text := append([]byte(entry.text), 0)
+		tiff = order.AppendUint16(tiff, 2)
+		tiff = order.AppendUint32(tiff, uint32(len(text)))
+		if len(text) <= 4 {
+			tiff = append(tiff, make([]byte, 4)...)
+			copy(tiff[len(tiff)-4:], text)
+			continue
+		}
+		tiff = order.AppendUint32(tiff, uint32(values+len(data)))
+		data = append(data, text...)
+	}
+	tiff = order.AppendUint32(tiff, 0)
+	tiff = append(tiff, data...)
+
+	return jpegSegment(0xe1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// testJPEGTail are the segments following the metadata, they are not
+// decoded when the orientation is saved
+var testJPEGTail = [][]byte{
+	jpegSegment(0xdb, bytes.Repeat([]byte{1}, 65)),
+	jpegSegment(0xda, []byte{1, 2, 3}),
+}
+
+func testJPEG(segments ...[]byte) []byte {
+	return buildJPEG(append(segments, testJPEGTail...)...)
+}
+
+// saveTestOrientation writes data to a file with the extension ext, saves
+// the orientation to it and returns the resulting file
+func saveTestOrientation(t *testing.T, ext string, data []byte, orientation Orientation) []byte {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "image"+ext)
+	err := os.WriteFile(filename, data, 0644)
+	if err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	err = SaveOrientation(filename, orientation)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+	return result
+}
+
+func decodeTestExif(t *testing.T, data []byte) *exif.Exif {
+	t.Helper()
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode exif: %s", err)
+	}
+	return x
+}
+
+func checkExifOrientation(t *testing.T, x *exif.Exif, expected int) {
+	t.Helper()
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		t.Fatalf("failed to read orientation: %s", err)
+	}
+	if value, _ := tag.Int(0); value != expected {
+		t.Errorf("orientation is %d, expected %d", value, expected)
+	}
+}
+
+func TestSaveJPEGOrientationInPlace(t *testing.T) {
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			data := testJPEG(
+				jpegSegment(0xe0, []byte("JFIF\x00")),
+				buildExifSegment(order,
+					exifEntry{tag: 0x010f, text: "Camera maker"},
+					exifEntry{tag: exifOrientationTag, short: 6},
+					exifEntry{tag: 0x0131, text: "Software"},
+				),
+			)
+
+			// rotated by 90 degrees once more is upside down
+			result := saveTestOrientation(t, ".jpg", data, orientationMap[6])
+			checkExifOrientation(t, decodeTestExif(t, result), 3)
+
+			if len(result) != len(data) {
+				t.Fatalf("file size changed from %d to %d", len(data), len(result))
+			}
+			location, err := findJPEGOrientation(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i := range data {
+				if data[i] != result[i] && (i < location.offset || i >= location.offset+2) {
+					t.Errorf("byte %d outside of the orientation value changed", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveJPEGOrientationAddTag(t *testing.T) {
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			data := testJPEG(
+				jpegSegment(0xe0, []byte("JFIF\x00")),
+				buildExifSegment(order,
+					exifEntry{tag: 0x010f, text: "Camera maker"},
+					exifEntry{tag: 0x0131, text: "Software"},
+				),
+			)
+
+			result := saveTestOrientation(t, ".jpg", data, orientationMap[8])
+			x := decodeTestExif(t, result)
+			checkExifOrientation(t, x, 8)
+
+			// the values stored after the old IFD are still found
+			for tag, expected := range map[exif.FieldName]string{exif.Make: "Camera maker", exif.Software: "Software"} {
+				value, err := x.Get(tag)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", tag, err)
+				}
+				if text, _ := value.StringVal(); text != expected {
+					t.Errorf("%s is %q, expected %q", tag, text, expected)
+				}
+			}
+
+			tail := bytes.Join(append(testJPEGTail, []byte{0xff, 0xd9}), nil)
+			if !bytes.HasSuffix(result, tail) {
+				t.Errorf("segments after the exif segment changed")
+			}
+		})
+	}
+}
+
+func TestSaveJPEGOrientationNewSegment(t *testing.T) {
+	jfif := jpegSegment(0xe0, []byte("JFIF\x00"))
+	comment := jpegSegment(0xfe, []byte("comment"))
+
+	tests := []struct {
+		name     string
+		before   [][]byte
+		after    [][]byte
+		expected int
+	}{
+		{"jfif", [][]byte{jfif}, [][]byte{comment}, 6},
+		{"without jfif", nil, [][]byte{comment}, 6},
+		{"jfif not first", nil, [][]byte{comment, jfif}, 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := testJPEG(append(test.before, test.after...)...)
+			result := saveTestOrientation(t, ".jpg", data, orientationMap[test.expected])
+
+			expected := testJPEG(append(append(test.before, newExifSegment(test.expected)), test.after...)...)
+			if !bytes.Equal(result, expected) {
+				t.Errorf("exif segment is not inserted after %d segments", len(test.before))
+			}
+			checkExifOrientation(t, decodeTestExif(t, result), test.expected)
+		})
+	}
+}
+
+func TestSaveJPEGOrientationInvalid(t *testing.T) {
+	shortSegment := func(length byte) []byte {
+		return buildJPEG([]byte{0xff, 0xe0, 0, length}, []byte{1, 2, 3})
+	}
+	longSegment := buildJPEG([]byte{0xff, 0xe0, 0xff, 0xff, 1, 2, 3})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a jpeg", []byte("GIF89a")},
+		{"segment length 0", shortSegment(0)},
+		{"segment length 1", shortSegment(1)},
+		{"segment beyond file", longSegment},
+		{"invalid marker", buildJPEG([]byte{0x00, 0xe0, 0, 2})},
+		{"invalid exif byte order", testJPEG(jpegSegment(0xe1, []byte("Exif\x00\x00XX\x00*\x00\x00\x00\x08\x00\x00")))},
+		{"exif ifd beyond segment", testJPEG(jpegSegment(0xe1, []byte("Exif\x00\x00MM\x00*\x00\x00\xff\xff")))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "image.jpg")
+			err := os.WriteFile(filename, test.data, 0644)
+			if err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+
+			err = writeJPEGOrientation(filename, 6)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+
+			result, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("failed to read file: %s", err)
+			}
+			if !bytes.Equal(result, test.data) {
+				t.Errorf("file changed")
+			}
+		})
+	}
+}
+
+// testPNGImages have a different pixel format each and a different color
+// for every pixel
+func testPNGImages() map[string]image.Image {
+	rgba := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	gray := image.NewGray16(image.Rect(0, 0, 3, 2))
+	palette := color.Palette{}
+	for i := 0; i < 6; i++ {
+		palette = append(palette, color.NRGBA{R: uint8(i * 40), G: 255 - uint8(i*40), B: 7, A: 255})
+	}
+	paletted := image.NewPaletted(image.Rect(0, 0, 3, 2), palette)
+
+	for i := 0; i < 6; i++ {
+		x, y := i%3, i/3
+		rgba.Set(x, y, color.NRGBA{R: uint8(i * 40), G: uint8(i), B: 200, A: 100 + uint8(i)})
+		gray.Set(x, y, color.Gray16{Y: uint16(i*10000 + 1)})
+		paletted.SetColorIndex(x, y, uint8(i))
+	}
+
+	return map[string]image.Image{"8 bit": rgba, "16 bit": gray, "paletted": paletted}
+}
+
+func encodeTestPNG(t *testing.T, i image.Image, chunks ...pngChunk) []byte {
+	var encoded bytes.Buffer
+	err := png.Encode(&encoded, i)
+	if err != nil {
+		t.Fatalf("failed to encode png: %s", err)
+	}
+
+	original, err := readPNGChunks(encoded.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result := bytes.NewBuffer(append([]byte{}, encoded.Bytes()[:8]...))
+	for _, chunk := range original {
+		writePNGChunk(result, chunk)
+		if chunk.Type == "IHDR" {
+			for _, extra := range chunks {
+				writePNGChunk(result, extra)
+			}
+		}
+	}
+	return result.Bytes()
+}
+
+func TestSavePNGOrientation(t *testing.T) {
+	text := pngChunk{Type: "tEXt", Data: []byte("Title\x00Test")}
+	density := pngChunk{Type: "pHYs", Data: []byte{0, 0, 0, 10, 0, 0, 0, 20, 1}}
+	swapped := []byte{0, 0, 0, 20, 0, 0, 0, 10, 1}
+	private := pngChunk{Type: "prVt", Data: []byte{1}}
+
+	for name, original := range testPNGImages() {
+		for value, orientation := range orientationMap {
+			t.Run(fmt.Sprintf("%s orientation %d", name, value), func(t *testing.T) {
+				data := encodeTestPNG(t, original, text, density, private)
+				result := saveTestOrientation(t, ".png", data, orientation)
+
+				decoded, err := png.Decode(bytes.NewReader(result))
+				if err != nil {
+					t.Fatalf("failed to decode png: %s", err)
+				}
+				if reflect.TypeOf(decoded) != reflect.TypeOf(original) {
+					t.Errorf("pixel format changed from %T to %T", original, decoded)
+				}
+
+				expected := orientImage(original, orientation)
+				if decoded.Bounds() != expected.Bounds() {
+					t.Fatalf("size is %v, expected %v", decoded.Bounds(), expected.Bounds())
+				}
+				for y := 0; y < expected.Bounds().Dy(); y++ {
+					for x := 0; x < expected.Bounds().Dx(); x++ {
+						c := color.NRGBA64Model.Convert(decoded.At(x, y))
+						e := color.NRGBA64Model.Convert(expected.At(x, y))
+						if c != e {
+							t.Errorf("pixel %d, %d is %v, expected %v", x, y, c, e)
+						}
+					}
+				}
+
+				chunks, err := readPNGChunks(result)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				kept := map[string][]byte{}
+				for _, chunk := range chunks {
+					kept[chunk.Type] = chunk.Data
+				}
+				if !bytes.Equal(kept["tEXt"], text.Data) {
+					t.Errorf("text chunk is %q", kept["tEXt"])
+				}
+				if _, ok := kept["prVt"]; ok {
+					t.Errorf("unknown chunk is kept")
+				}
+				expectedDensity := density.Data
+				if orientation.numRotations%2 == 1 {
+					expectedDensity = swapped
+				}
+				if !bytes.Equal(kept["pHYs"], expectedDensity) {
+					t.Errorf("pixel density is %v, expected %v", kept["pHYs"], expectedDensity)
+				}
+			})
+		}
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// a b
+	// c d
+	src := image.NewGray(image.Rect(0, 0, 2, 2))
+	copy(src.Pix, "abcd")
+
+	tests := map[int]string{
+		1: "abcd",
+		2: "badc",
+		3: "dcba",
+		4: "cdab",
+		5: "acbd",
+		6: "cadb",
+		7: "dbca",
+		8: "bdac",
+	}
+	for value, expected := range tests {
+		dst := orientImage(src, orientationMap[value]).(*image.Gray)
+		if string(dst.Pix) != expected {
+			t.Errorf("orientation %d is %q, expected %q", value, dst.Pix, expected)
+		}
+	}
+}
+
+func TestOrientationThen(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(src.Pix, "abcdef")
+
+	for first, o := range orientationMap {
+		if o.ExifValue() != first {
+			t.Errorf("exif value of %v is %d, expected %d", o, o.ExifValue(), first)
+		}
+		if o.Then(DefaultOrientation) != o || DefaultOrientation.Then(o) != o {
+			t.Errorf("orientation %d combined with the default is not itself", first)
+		}
+
+		for second, next := range orientationMap {
+			combined := o.Then(next)
+			if _, ok := orientationMap[combined.ExifValue()]; !ok || orientationMap[combined.ExifValue()] != combined {
+				t.Errorf("orientation %d then %d is %v, which has no exif value", first, second, combined)
+			}
+
+			expected := orientImage(orientImage(src, o), next).(*image.Gray)
+			actual := orientImage(src, combined).(*image.Gray)
+			if !bytes.Equal(actual.Pix, expected.Pix) || actual.Rect != expected.Rect {
+				t.Errorf("orientation %d then %d is %d, which differs from applying both", first, second, combined.ExifValue())
+			}
+		}
+	}
+}
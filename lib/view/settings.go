@@ -3,6 +3,7 @@ package view
 import (
 	"encoding/json"
 	"github.com/veandco/go-sdl2/sdl"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,10 +14,73 @@ type WindowSettings struct {
 	Y uint32
 	W uint32
 	H uint32
+	// Fullscreen is restored on start, the geometry above is always that of
+	// the window when it is not fullscreen
+	Fullscreen bool
 }
 
 type Settings struct {
 	Window WindowSettings
+
+	ToneMapOperator ToneMapOperator
+
+	ColorManagement bool
+	// DisplayProfile is the path to the ICC profile of the display, sRGB is
+	// assumed when empty
+	DisplayProfile string
+
+	// FitMode is applied to every image that is loaded
+	FitMode FitMode
+	// RememberViews restores the zoom, position and rotation of files shown
+	// before in the same session
+	RememberViews bool
+
+	// ZoomDuration is the time in seconds a zoom step is animated, 0 zooms
+	// instantly
+	ZoomDuration float64
+	// KineticFriction is the rate at which the view slows down after a drag
+	// is released, 0 disables kinetic panning
+	KineticFriction float64
+
+	// MinZoom and MaxZoom limit the scale of the image
+	MinZoom float64
+	MaxZoom float64
+	// CenterSmallImages keeps images that fit in the window centered
+	CenterSmallImages bool
+	// PanMargin is the number of pixels of the image that stay visible when
+	// it is moved towards the edge of the window
+	PanMargin float64
+
+	TextureFilter TextureFilter
+	// NearestFilterThreshold is the scale from which the auto texture filter
+	// switches to nearest neighbor sampling
+	NearestFilterThreshold float64
+
+	PixelGrid PixelGridSettings
+	Navigator NavigatorSettings
+	Loupe     LoupeSettings
+
+	// Histogram shows the histogram of the image
+	Histogram bool
+	// StickyAdjustments keeps the brightness, contrast and other adjustments
+	// when another file is loaded
+	StickyAdjustments bool
+
+	// Background is the color around the image, CustomBackground is used
+	// for BackgroundCustom
+	Background       Background
+	CustomBackground Color
+	Checkerboard     CheckerboardSettings
+
+	// HideCursorDelay is the time in seconds without mouse movement after
+	// which the cursor is hidden while fullscreen, 0 never hides it
+	HideCursorDelay float64
+
+	// ConfirmSaveOrientation asks before the orientation is written to a file
+	ConfirmSaveOrientation bool
+	// OrientationBackup keeps a copy of a file before its orientation is
+	// first written to it
+	OrientationBackup bool
 }
 
 var DefaultSettings = Settings{
@@ -25,7 +89,58 @@ var DefaultSettings = Settings{
 		Y: 0,
 		W: 1200,
 		H: 900,
+
+		Fullscreen: false,
+	},
+	ToneMapOperator: ToneMapClamp,
+	ColorManagement: true,
+	DisplayProfile:  "",
+
+	FitMode:       FitShrink,
+	RememberViews: false,
+
+	ZoomDuration:    0.15,
+	KineticFriction: 5,
+
+	MinZoom:           0.01,
+	MaxZoom:           100,
+	CenterSmallImages: true,
+	PanMargin:         64,
+
+	TextureFilter:          TextureFilterAuto,
+	NearestFilterThreshold: 2,
+
+	PixelGrid: PixelGridSettings{
+		Enabled:   false,
+		Threshold: 8,
+		Color:     NewColor(0.5, 0.5, 0.5, 0.5),
+	},
+	Navigator: NavigatorSettings{
+		Enabled: true,
+		Size:    200,
 	},
+	Loupe: LoupeSettings{
+		Factor: 4,
+		Size:   240,
+		Round:  true,
+	},
+
+	Histogram:         false,
+	StickyAdjustments: false,
+
+	Background:       BackgroundDark,
+	CustomBackground: NewColor(0.25, 0.25, 0.3, 1),
+	Checkerboard: CheckerboardSettings{
+		Enabled: true,
+		Size:    8,
+		Light:   NewColor(0.8, 0.8, 0.8, 1),
+		Dark:    NewColor(0.6, 0.6, 0.6, 1),
+	},
+
+	HideCursorDelay: 2,
+
+	ConfirmSaveOrientation: true,
+	OrientationBackup:      true,
 }
 
 const SettingsFilename = "settings.json"
@@ -37,8 +152,15 @@ func LoadSettings() Settings {
 		log.Printf("could not open settings file %s%s\n", settingPath, SettingsFilename)
 		return DefaultSettings
 	}
-	var settings Settings
-	err = json.NewDecoder(file).Decode(&settings)
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("failed to read settings: %s", err)
+		return DefaultSettings
+	}
+
+	settings, err := parseSettings(data)
 	if err != nil {
 		log.Printf("failed to unmarshal settings: %s", err)
 		return DefaultSettings
@@ -46,6 +168,33 @@ func LoadSettings() Settings {
 	return settings
 }
 
+// legacySettings are settings of earlier versions that map to current ones
+type legacySettings struct {
+	// BlackBackground was replaced by Background
+	BlackBackground bool
+	Background      *Background
+}
+
+// parseSettings unmarshals settings on top of the defaults and migrates
+// legacy settings
+func parseSettings(data []byte) (Settings, error) {
+	settings := DefaultSettings
+	err := json.Unmarshal(data, &settings)
+	if err != nil {
+		return DefaultSettings, err
+	}
+
+	var legacy legacySettings
+	err = json.Unmarshal(data, &legacy)
+	if err != nil {
+		return DefaultSettings, err
+	}
+	if legacy.BlackBackground && legacy.Background == nil {
+		settings.Background = BackgroundBlack
+	}
+	return settings, nil
+}
+
 func SaveSettings(settings Settings) {
 	settingPath := sdl.GetPrefPath("demontpx", "go-view")
 	file, err := os.OpenFile(filepath.Join(settingPath, SettingsFilename), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
@@ -0,0 +1,29 @@
+package view
+
+import "testing"
+
+func TestParseSettingsBackground(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected Background
+	}{
+		{"default", `{}`, DefaultSettings.Background},
+		{"black background", `{"BlackBackground": true}`, BackgroundBlack},
+		{"no black background", `{"BlackBackground": false}`, DefaultSettings.Background},
+		{"background", `{"Background": 1}`, BackgroundLight},
+		{"background and black background", `{"BlackBackground": true, "Background": 3}`, BackgroundWhite},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings, err := parseSettings([]byte(test.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if settings.Background != test.expected {
+				t.Errorf("background is %s, expected %s", settings.Background, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package view
+
+import (
+	"fmt"
+
+	gl "github.com/chsc/gogl/gl33"
+)
+
+type ShaderProgram struct {
+	Id gl.Uint
+
+	uniforms map[string]gl.Int
+}
+
+func NewShaderProgram(vertexSource, fragmentSource string) (*ShaderProgram, error) {
+	vertexShader, err := compileShader(gl.VERTEX_SHADER, vertexSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile vertex shader: %s", err)
+	}
+	defer gl.DeleteShader(vertexShader)
+
+	fragmentShader, err := compileShader(gl.FRAGMENT_SHADER, fragmentSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile fragment shader: %s", err)
+	}
+	defer gl.DeleteShader(fragmentShader)
+
+	id := gl.CreateProgram()
+	gl.AttachShader(id, vertexShader)
+	gl.AttachShader(id, fragmentShader)
+	gl.LinkProgram(id)
+
+	var status gl.Int
+	gl.GetProgramiv(id, gl.LINK_STATUS, &status)
+	if status == gl.FALSE {
+		var length gl.Int
+		gl.GetProgramiv(id, gl.INFO_LOG_LENGTH, &length)
+		log := infoLog(length, func(size gl.Sizei, log *gl.Char) {
+			gl.GetProgramInfoLog(id, size, nil, log)
+		})
+		gl.DeleteProgram(id)
+		return nil, fmt.Errorf("failed to link shader program: %s", log)
+	}
+
+	return &ShaderProgram{
+		Id:       id,
+		uniforms: map[string]gl.Int{},
+	}, nil
+}
+
+func compileShader(shaderType gl.Enum, source string) (gl.Uint, error) {
+	shader := gl.CreateShader(shaderType)
+
+	glSource := gl.GLString(source)
+	defer gl.GLStringFree(glSource)
+	gl.ShaderSource(shader, 1, &glSource, nil)
+	gl.CompileShader(shader)
+
+	var status gl.Int
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status == gl.FALSE {
+		var length gl.Int
+		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &length)
+		log := infoLog(length, func(size gl.Sizei, log *gl.Char) {
+			gl.GetShaderInfoLog(shader, size, nil, log)
+		})
+		gl.DeleteShader(shader)
+		return 0, fmt.Errorf("%s", log)
+	}
+
+	return shader, nil
+}
+
+func infoLog(length gl.Int, read func(size gl.Sizei, log *gl.Char)) string {
+	if length <= 0 {
+		return ""
+	}
+	log := gl.GLStringAlloc(gl.Sizei(length))
+	defer gl.GLStringFree(log)
+	read(gl.Sizei(length), log)
+	return gl.GoString(log)
+}
+
+func (p *ShaderProgram) Use() {
+	gl.UseProgram(p.Id)
+}
+
+func (p *ShaderProgram) Unuse() {
+	gl.UseProgram(0)
+}
+
+func (p *ShaderProgram) Uniform(name string) gl.Int {
+	location, ok := p.uniforms[name]
+	if !ok {
+		glName := gl.GLString(name)
+		location = gl.GetUniformLocation(p.Id, glName)
+		gl.GLStringFree(glName)
+		p.uniforms[name] = location
+	}
+	return location
+}
+
+func (p *ShaderProgram) SetInt(name string, value int) {
+	gl.Uniform1i(p.Uniform(name), gl.Int(value))
+}
+
+func (p *ShaderProgram) SetFloat(name string, value float64) {
+	gl.Uniform1f(p.Uniform(name), gl.Float(value))
+}
+
+func (p *ShaderProgram) Destroy() {
+	gl.DeleteProgram(p.Id)
+}
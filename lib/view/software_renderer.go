@@ -0,0 +1,333 @@
+package view
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// SoftwareRenderer draws into an image in memory, following the GL renderer
+// closely enough to compare frames without a display or GPU. Colors are
+// blended like the GL renderer does with straight alpha; frames drawn on an
+// opaque background are valid image.RGBA values.
+type SoftwareRenderer struct {
+	Image *image.RGBA
+	// MaxSize is the maximum image size, small values force tiling
+	MaxSize int
+
+	transform  Transform
+	clip       Clip
+	conversion colorConversion
+}
+
+// softwareImage holds either 8-bit or float pixels, the origin of both is
+// the top left corner of the image.
+type softwareImage struct {
+	w, h   int
+	pixels *image.NRGBA
+	float  *FloatImage
+}
+
+func (i *softwareImage) Destroy() {
+	i.pixels = nil
+	i.float = nil
+}
+
+func NewSoftwareRenderer(w, h int) *SoftwareRenderer {
+	r := &SoftwareRenderer{
+		MaxSize:   4096,
+		transform: IdentityTransform,
+	}
+	r.SetViewport(float64(w), float64(h))
+	return r
+}
+
+// SetViewport starts a new image when the size changes
+func (r *SoftwareRenderer) SetViewport(w, h float64) {
+	bounds := image.Rect(0, 0, int(w), int(h))
+	if r.Image == nil || r.Image.Rect != bounds {
+		r.Image = image.NewRGBA(bounds)
+	}
+}
+
+func (r *SoftwareRenderer) MaxImageSize() int {
+	return r.MaxSize
+}
+
+func (r *SoftwareRenderer) NewImage(pixels image.Image, rect image.Rectangle) RendererImage {
+	i := &softwareImage{
+		w: rect.Dx(),
+		h: rect.Dy(),
+	}
+
+	if p, ok := pixels.(*FloatImage); ok {
+		i.float = NewFloatImage(i.w, i.h, p.Linear)
+		for y := 0; y < i.h; y++ {
+			copy(i.float.Pix[i.float.offset(0, y):][:i.w*4], p.Pix[p.offset(rect.Min.X, rect.Min.Y+y):])
+		}
+		return i
+	}
+
+	p, ok := pixels.(*image.NRGBA)
+	if !ok {
+		p = convertImage(pixels, rect)
+	}
+	i.pixels = image.NewNRGBA(image.Rect(0, 0, i.w, i.h))
+	for y := 0; y < i.h; y++ {
+		copy(i.pixels.Pix[i.pixels.PixOffset(0, y):][:i.w*4], p.Pix[p.PixOffset(rect.Min.X, rect.Min.Y+y):])
+	}
+	return i
+}
+
+func (r *SoftwareRenderer) ReadPixel(ri RendererImage, x, y int) [4]float64 {
+	return ri.(*softwareImage).at(x, y)
+}
+
+func (r *SoftwareRenderer) Clear(c Color) {
+	value := color.RGBA{R: toByte(c.R), G: toByte(c.G), B: toByte(c.B), A: toByte(c.A)}
+	for o := 0; o < len(r.Image.Pix); o += 4 {
+		r.Image.Pix[o+0] = value.R
+		r.Image.Pix[o+1] = value.G
+		r.Image.Pix[o+2] = value.B
+		r.Image.Pix[o+3] = value.A
+	}
+}
+
+func (r *SoftwareRenderer) SetTransform(t Transform) {
+	r.transform = t
+}
+
+func (r *SoftwareRenderer) SetClip(clip Clip) {
+	r.clip = clip
+}
+
+// pixelRange returns the pixels of which the center may lie within the
+// transformed rect, clipped to the image.
+func (r *SoftwareRenderer) pixelRange(rect Rect) image.Rectangle {
+	rect = r.transform.BoundingRect(rect)
+	area := image.Rect(
+		int(math.Ceil(rect.X-0.5)),
+		int(math.Ceil(rect.Y-0.5)),
+		int(math.Ceil(rect.X2()-0.5)),
+		int(math.Ceil(rect.Y2()-0.5)),
+	)
+	return area.Intersect(r.Image.Rect)
+}
+
+// blend mixes a color into a pixel with the source alpha, like the GL blend
+// function, unless the pixel is clipped
+func (r *SoftwareRenderer) blend(x, y int, c [4]float64) {
+	if !r.clip.Contains(float64(x)+0.5, float64(y)+0.5) {
+		return
+	}
+	pixel := r.Image.Pix[r.Image.PixOffset(x, y):][:4]
+	a := min(max(c[3], 0), 1)
+	for channel := 0; channel < 4; channel++ {
+		value := c[channel]
+		if channel == 3 {
+			value = a
+		}
+		pixel[channel] = toByte(min(max(value, 0), 1)*a + float64(pixel[channel])/0xff*(1-a))
+	}
+}
+
+// forEachPixel calls draw for every pixel of which the center lies within
+// the transformed rect, with the center in untransformed coordinates.
+func (r *SoftwareRenderer) forEachPixel(rect Rect, draw func(x, y int, localX, localY float64)) {
+	inverse := r.transform.Invert()
+	area := r.pixelRange(rect)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			localX, localY := inverse.Apply(float64(x)+0.5, float64(y)+0.5)
+			if localX < rect.X || localX >= rect.X2() || localY < rect.Y || localY >= rect.Y2() {
+				continue
+			}
+			draw(x, y, localX, localY)
+		}
+	}
+}
+
+func (r *SoftwareRenderer) DrawQuad(rect Rect, c Color) {
+	value := [4]float64{c.R, c.G, c.B, c.A}
+	r.forEachPixel(rect, func(x, y int, _, _ float64) {
+		r.blend(x, y, value)
+	})
+}
+
+func (r *SoftwareRenderer) DrawCheckerboard(rect Rect, x, y, size float64, light, dark Color) {
+	r.forEachPixel(rect, func(px, py int, localX, localY float64) {
+		c := light
+		if checkerboardDark(localX-x, localY-y, size) {
+			c = dark
+		}
+		r.blend(px, py, [4]float64{c.R, c.G, c.B, c.A})
+	})
+}
+
+// DrawImage samples the image for every covered pixel. Minified images are
+// box filtered over the footprint of the pixel, approximating mipmaps.
+func (r *SoftwareRenderer) DrawImage(ri RendererImage, source, rect Rect, options ImageOptions) {
+	i := ri.(*softwareImage)
+	if rect.W <= 0 || rect.H <= 0 {
+		return
+	}
+
+	if options.ColorManagement.Enabled {
+		display := options.ColorManagement.Display
+		if display == nil {
+			display = SRGBProfile
+		}
+		r.conversion.update(options.Profile, display)
+	}
+
+	// image pixels per untransformed unit, and per window pixel
+	scaleX := source.W / rect.W
+	scaleY := source.H / rect.H
+	footprintX := scaleX / r.transform.Scale()
+	footprintY := scaleY / r.transform.Scale()
+
+	magnified := footprintX <= 1 && footprintY <= 1
+	nearest := options.Sampling == SamplingNearest ||
+		(options.Sampling == SamplingNearestMagnified && magnified)
+
+	r.forEachPixel(rect, func(x, y int, localX, localY float64) {
+		u := source.X + (localX-rect.X)*scaleX
+		v := source.Y + (localY-rect.Y)*scaleY
+
+		var c [4]float64
+		switch {
+		case nearest:
+			c = i.at(int(u), int(v))
+		case magnified:
+			c = i.bilinear(u, v)
+		default:
+			c = i.box(u, v, footprintX, footprintY)
+		}
+
+		c = options.Adjustments.Apply(r.mapColor(c, &options))
+		c = options.DisplayMode.Apply(c, float64(x)+0.5, float64(y)+0.5)
+		r.blend(x, y, c)
+	})
+}
+
+// mapColor converts a sampled value to a display value, matching the image
+// shader.
+func (r *SoftwareRenderer) mapColor(c [4]float64, options *ImageOptions) [4]float64 {
+	managed := options.ColorManagement.Enabled
+
+	var rgb [3]float64
+	for channel := range rgb {
+		rgb[channel] = max(c[channel], 0)
+		if options.Linear {
+			continue
+		}
+		if managed {
+			rgb[channel] = lookupCurve(r.conversion.sourceCurves, channel, rgb[channel])
+		} else {
+			rgb[channel] = srgbToLinear(rgb[channel])
+		}
+	}
+
+	if managed {
+		m := r.conversion.matrix
+		rgb = [3]float64{
+			max(m[0]*rgb[0]+m[1]*rgb[1]+m[2]*rgb[2], 0),
+			max(m[3]*rgb[0]+m[4]*rgb[1]+m[5]*rgb[2], 0),
+			max(m[6]*rgb[0]+m[7]*rgb[1]+m[8]*rgb[2], 0),
+		}
+	}
+
+	for channel := range rgb {
+		value := options.ToneMapping.Map(rgb[channel])
+		if managed {
+			c[channel] = lookupCurve(r.conversion.displayCurves, channel, value)
+		} else {
+			c[channel] = linearToSrgb(min(max(value, 0), 1))
+		}
+	}
+
+	return c
+}
+
+func (r *SoftwareRenderer) DrawText(text string, x, y float64, c Color) {
+	for _, char := range text {
+		index := fontGlyphIndex(char)
+		for gy := 0; gy < fontGlyphH; gy++ {
+			for gx := 0; gx < fontGlyphW; gx++ {
+				if char != ' ' && fontPixel(index, gx, gy) {
+					r.DrawQuad(NewRect(x+float64(gx)*TextScale, y+float64(gy)*TextScale, TextScale, TextScale), c)
+				}
+			}
+		}
+		x += fontAdvance * TextScale
+	}
+}
+
+// Present does nothing, the frame is read from Image
+func (r *SoftwareRenderer) Present() {
+}
+
+func (r *SoftwareRenderer) Destroy() {
+	r.Image = nil
+}
+
+// at returns a pixel, clamping the coordinates to the edge like the GL
+// textures do
+func (i *softwareImage) at(x, y int) [4]float64 {
+	x = min(max(x, 0), i.w-1)
+	y = min(max(y, 0), i.h-1)
+
+	if i.float != nil {
+		p := i.float.Pix[i.float.offset(x, y):][:4]
+		return [4]float64{float64(p[0]), float64(p[1]), float64(p[2]), float64(p[3])}
+	}
+	p := i.pixels.Pix[i.pixels.PixOffset(x, y):][:4]
+	return [4]float64{float64(p[0]) / 0xff, float64(p[1]) / 0xff, float64(p[2]) / 0xff, float64(p[3]) / 0xff}
+}
+
+func (i *softwareImage) bilinear(u, v float64) [4]float64 {
+	u -= 0.5
+	v -= 0.5
+	x, y := math.Floor(u), math.Floor(v)
+	fx, fy := u-x, v-y
+
+	c00 := i.at(int(x), int(y))
+	c10 := i.at(int(x)+1, int(y))
+	c01 := i.at(int(x), int(y)+1)
+	c11 := i.at(int(x)+1, int(y)+1)
+
+	var c [4]float64
+	for channel := range c {
+		top := c00[channel]*(1-fx) + c10[channel]*fx
+		bottom := c01[channel]*(1-fx) + c11[channel]*fx
+		c[channel] = top*(1-fy) + bottom*fy
+	}
+	return c
+}
+
+func (i *softwareImage) box(u, v, scaleX, scaleY float64) [4]float64 {
+	x0 := int(math.Floor(u - scaleX/2))
+	y0 := int(math.Floor(v - scaleY/2))
+	x1 := max(int(math.Ceil(u+scaleX/2)), x0+1)
+	y1 := max(int(math.Ceil(v+scaleY/2)), y0+1)
+
+	var c [4]float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p := i.at(x, y)
+			for channel := range c {
+				c[channel] += p[channel]
+			}
+		}
+	}
+
+	n := float64((x1 - x0) * (y1 - y0))
+	for channel := range c {
+		c[channel] /= n
+	}
+	return c
+}
+
+func toByte(v float64) uint8 {
+	return uint8(min(max(v, 0), 1)*0xff + 0.5)
+}
@@ -0,0 +1,259 @@
+package view
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	testRed   = color.RGBA{R: 255, A: 255}
+	testGreen = color.RGBA{G: 255, A: 255}
+	testBlue  = color.RGBA{B: 255, A: 255}
+	testWhite = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	testBlack = color.RGBA{A: 255}
+	testEmpty = color.RGBA{}
+)
+
+type testPixel struct {
+	x, y  int
+	color color.RGBA
+}
+
+// testQuadrants returns a 2x2 image with red, green, blue and white pixels
+// from left to right and top to bottom
+func testQuadrants() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, testRed)
+	img.Set(1, 0, testGreen)
+	img.Set(0, 1, testBlue)
+	img.Set(1, 1, testWhite)
+	return img
+}
+
+// drawTestView draws the quadrants like a frame of the viewer, centered in
+// an 8x8 window at twice their size, so each image pixel covers 2x2 window
+// pixels from 2, 2 to 6, 6
+func drawTestView(view View, options ImageOptions, grid PixelGridSettings) *image.RGBA {
+	r := NewSoftwareRenderer(8, 8)
+	m := &Main{Renderer: r}
+	m.Settings.PixelGrid = grid
+
+	view.X, view.Y = 4, 4
+	view.W, view.H = 8, 8
+	view.Scale = 2
+
+	t := newTiledTexture(r, testQuadrants())
+	m.drawView(t, view, NewRect(0, 0, 8, 8), options)
+	return r.Image
+}
+
+func checkPixels(t *testing.T, img *image.RGBA, pixels []testPixel) {
+	t.Helper()
+	for _, p := range pixels {
+		if c := img.RGBAAt(p.x, p.y); c != p.color {
+			t.Errorf("pixel %d, %d is %v, expected %v", p.x, p.y, c, p.color)
+		}
+	}
+}
+
+func TestSoftwareRendererView(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    View
+		options ImageOptions
+		grid    PixelGridSettings
+		pixels  []testPixel
+	}{
+		{
+			"nearest",
+			View{},
+			ImageOptions{Sampling: SamplingNearest},
+			PixelGridSettings{},
+			[]testPixel{
+				{1, 1, testEmpty},
+				{2, 2, testRed},
+				{3, 3, testRed},
+				{4, 2, testGreen},
+				{5, 3, testGreen},
+				{2, 4, testBlue},
+				{5, 5, testWhite},
+				{6, 6, testEmpty},
+			},
+		},
+		{
+			"linear",
+			View{},
+			ImageOptions{Sampling: SamplingLinear},
+			PixelGridSettings{},
+			[]testPixel{
+				// the edges are clamped, inner pixels are interpolated
+				{2, 2, testRed},
+				{3, 2, color.RGBA{R: 191, G: 64, A: 255}},
+				{4, 2, color.RGBA{R: 64, G: 191, A: 255}},
+				{5, 2, testGreen},
+				{2, 3, color.RGBA{R: 191, B: 64, A: 255}},
+				{3, 3, color.RGBA{R: 159, G: 64, B: 64, A: 255}},
+			},
+		},
+		{
+			"rotated and flipped",
+			View{Rotation: 90, FlipH: true},
+			ImageOptions{Sampling: SamplingNearest},
+			PixelGridSettings{},
+			[]testPixel{
+				// mirrored along the diagonal from the top right
+				{2, 2, testWhite},
+				{4, 2, testGreen},
+				{2, 4, testBlue},
+				{5, 5, testRed},
+			},
+		},
+		{
+			"pixel grid",
+			View{},
+			ImageOptions{Sampling: SamplingNearest},
+			PixelGridSettings{Enabled: true, Threshold: 1, Color: NewColor(0, 0, 0, 1)},
+			[]testPixel{
+				{2, 2, testBlack},
+				{3, 3, testRed},
+				{4, 3, testBlack},
+				{5, 3, testGreen},
+				{3, 4, testBlack},
+				{5, 5, testWhite},
+				{6, 5, testBlack},
+				{1, 1, testEmpty},
+			},
+		},
+		{
+			"pixel grid below threshold",
+			View{},
+			ImageOptions{Sampling: SamplingNearest},
+			PixelGridSettings{Enabled: true, Threshold: 2, Color: NewColor(0, 0, 0, 1)},
+			[]testPixel{
+				{2, 2, testRed},
+				{4, 3, testGreen},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := drawTestView(test.view, test.options, test.grid)
+			checkPixels(t, img, test.pixels)
+		})
+	}
+}
+
+func TestSoftwareRendererClipEllipse(t *testing.T) {
+	r := NewSoftwareRenderer(8, 8)
+	r.SetClip(Clip{Shape: ClipEllipse, Rect: NewRect(0, 0, 8, 8)})
+	r.DrawQuad(NewRect(0, 0, 8, 8), NewColor(1, 1, 1, 1))
+
+	checkPixels(t, r.Image, []testPixel{
+		{0, 0, testEmpty},
+		{7, 0, testEmpty},
+		{0, 7, testEmpty},
+		{7, 7, testEmpty},
+		{4, 0, testWhite},
+		{0, 4, testWhite},
+		{3, 3, testWhite},
+		{4, 7, testWhite},
+	})
+}
+
+func TestSoftwareRendererText(t *testing.T) {
+	scale := TextScale
+	TextScale = 1
+	defer func() {
+		TextScale = scale
+	}()
+
+	r := NewSoftwareRenderer(12, 8)
+	// "!" lights the middle column apart from the second row from the bottom,
+	// "." the bottom two rows of the second and middle column
+	r.DrawText("!.", 0, 0, NewColor(1, 1, 1, 1))
+
+	var lit []testPixel
+	for y := 0; y < fontGlyphH; y++ {
+		for x := 0; x < 2*fontAdvance; x++ {
+			expected := testEmpty
+			switch {
+			case x == 2 && y != 5:
+				expected = testWhite
+			case (x == fontAdvance+1 || x == fontAdvance+2) && y >= 5:
+				expected = testWhite
+			}
+			lit = append(lit, testPixel{x, y, expected})
+		}
+	}
+	checkPixels(t, r.Image, lit)
+}
+
+// pixel values are read back from the tiles of the renderer
+func TestSoftwareRendererTexturePixel(t *testing.T) {
+	r := NewSoftwareRenderer(1, 1)
+	r.MaxSize = 1
+	texture := newTiledTexture(r, testQuadrants())
+	texture.pixels = nil
+
+	tests := []struct {
+		x, y     int
+		expected string
+	}{
+		{0, 0, "#ff0000"},
+		{1, 0, "#00ff00"},
+		{0, 1, "#0000ff"},
+		{1, 1, "#ffffff"},
+	}
+	for _, test := range tests {
+		value, ok := texture.Pixel(r, test.x, test.y)
+		if !ok || value.Hex() != test.expected {
+			t.Errorf("pixel %d, %d is %s, expected %s", test.x, test.y, value.Hex(), test.expected)
+		}
+	}
+
+	if _, ok := texture.Pixel(r, 2, 0); ok {
+		t.Errorf("pixel outside of the texture is available")
+	}
+}
+
+// tiles share a gutter with their neighbours, so filtering across tile
+// borders matches an image drawn as a single tile
+func TestSoftwareRendererTileGutter(t *testing.T) {
+	pixels := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range pixels.Pix {
+		pixels.Pix[i] = uint8(i * 37)
+	}
+
+	draw := func(maxSize int, scale float64) (*image.RGBA, *Texture, Renderer) {
+		size := int(8 * scale)
+		r := NewSoftwareRenderer(size, size)
+		r.MaxSize = maxSize
+		texture := newTiledTexture(r, pixels)
+		texture.DrawScale(r, float64(size)/2, float64(size)/2, scale, ImageOptions{Sampling: SamplingLinear})
+		return r.Image, texture, r
+	}
+
+	for _, scale := range []float64{3, 0.5} {
+		single, _, _ := draw(4096, scale)
+		tiled, texture, r := draw(4, scale)
+		if len(texture.Tiles) != 16 {
+			t.Fatalf("expected 16 tiles, got %d", len(texture.Tiles))
+		}
+		if !bytes.Equal(single.Pix, tiled.Pix) {
+			t.Errorf("tiles drawn at scale %g differ from a single image", scale)
+		}
+
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				value, ok := texture.Pixel(r, x, y)
+				expected := pixels.NRGBAAt(x, y)
+				if !ok || toByte(value.R) != expected.R || toByte(value.A) != expected.A {
+					t.Errorf("pixel %d, %d is %v, expected %v", x, y, value, expected)
+				}
+			}
+		}
+	}
+}
@@ -2,53 +2,149 @@ package view
 
 import (
 	"fmt"
+	"image"
+	"log"
 
-	gl "github.com/chsc/gogl/gl21"
 	"github.com/veandco/go-sdl2/gfx"
 	"github.com/veandco/go-sdl2/img"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 type Texture struct {
-	Id   gl.Uint
 	W, H float64
+
+	// Tiles cover the image in row major order, images larger than the
+	// maximum image size of the renderer are split into several tiles
+	Tiles []TextureTile
+
+	// Linear is set for textures holding linear light instead of sRGB values
+	Linear bool
+	// Profile is the embedded color profile, nil when the image is untagged
+	Profile *ColorProfile
+
+	// Orientation is the exif orientation applied to the file
+	Orientation Orientation
+
+	// Float is set for textures of float images
+	Float bool
+
+	// pixels are only kept until the histogram is computed, values are read
+	// back from the tiles afterwards
+	pixels image.Image
+
+	// pyramid is set for multi resolution images, of which the tiles are
+	// loaded on demand instead of up front
+	pyramid *pyramid
 }
 
-func NewTextureFromSurface(s *sdl.Surface) *Texture {
-	var id gl.Uint
+type TextureTile struct {
+	Image RendererImage
+	// Rect is the area of the tile in image pixels
+	Rect Rect
+	// Source is the area of Image drawn to Rect, in the pixels of Image
+	Source Rect
+}
 
-	gl.GenTextures(1, &id)
-	gl.BindTexture(gl.TEXTURE_2D, id)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, gl.Sizei(s.W), gl.Sizei(s.H), 0, formatFromSurface(s), gl.UNSIGNED_BYTE, gl.Pointer(s.Data()))
+// tileGutter is the number of pixels a tile shares with its neighbours, so
+// filtering at tile borders samples the neighbouring pixels instead of the
+// clamped edge. Mipmaps of strongly minified images average more pixels than
+// the gutter holds, so faint seams may remain there.
+const tileGutter = 1
+
+// newTiledTexture splits pixels in tiles no larger than the maximum image
+// size of the renderer, including their gutter.
+func newTiledTexture(r Renderer, pixels image.Image) *Texture {
+	bounds := pixels.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	_, float := pixels.(*FloatImage)
+	t := &Texture{
+		W:      float64(w),
+		H:      float64(h),
+		Float:  float,
+		pixels: pixels,
+	}
 
-	return &Texture{
-		Id: id,
-		W:  float64(s.W),
-		H:  float64(s.H),
+	tileSize := r.MaxImageSize()
+	gutter := tileGutter
+	if tileSize <= 2*gutter {
+		gutter = 0
+	}
+	// the gutter is only needed between tiles
+	step := func(size int) int {
+		if size <= tileSize {
+			return tileSize
+		}
+		return tileSize - 2*gutter
+	}
+	stepX, stepY := step(w), step(h)
+
+	for y := 0; y < h; y += stepY {
+		for x := 0; x < w; x += stepX {
+			tileW := min(stepX, w-x)
+			tileH := min(stepY, h-y)
+
+			outer := image.Rect(x-gutter, y-gutter, x+tileW+gutter, y+tileH+gutter).Intersect(image.Rect(0, 0, w, h))
+			t.Tiles = append(t.Tiles, TextureTile{
+				Image:  r.NewImage(pixels, outer.Add(bounds.Min)),
+				Rect:   NewRect(float64(x), float64(y), float64(tileW), float64(tileH)),
+				Source: NewRect(float64(x-outer.Min.X), float64(y-outer.Min.Y), float64(tileW), float64(tileH)),
+			})
+		}
 	}
+
+	return t
 }
 
-func formatFromSurface(s *sdl.Surface) gl.Enum {
-	if s.Format.BytesPerPixel == 4 {
-		if s.Format.Rmask == 0xff {
-			return gl.RGBA
-		} else {
-			return gl.BGRA
-		}
+func NewTextureFromSurface(r Renderer, s *sdl.Surface) (*Texture, error) {
+	// RGBA32 is stored as R, G, B, A bytes regardless of endianness
+	converted, err := s.ConvertFormat(uint32(sdl.PIXELFORMAT_RGBA32), 0)
+	if err != nil {
+		return nil, fmt.Errorf("error while converting surface: %s", err)
 	}
+	defer converted.Free()
 
-	if s.Format.Rmask == 0xff {
-		return gl.RGB
+	// the surface is freed, the copy is kept for the histogram
+	pixels := &image.NRGBA{
+		Pix:    append([]byte(nil), converted.Pixels()...),
+		Stride: int(converted.Pitch),
+		Rect:   image.Rect(0, 0, int(converted.W), int(converted.H)),
 	}
+	return newTiledTexture(r, pixels), nil
+}
 
-	return gl.BGR
+func NewTextureFromFloatImage(r Renderer, i *FloatImage) *Texture {
+	t := newTiledTexture(r, i)
+	t.Linear = i.Linear
+	return t
 }
 
-func NewTextureFromFile(file string, orientation Orientation) (*Texture, error) {
+// NewTextureFromFile loads an image file, notify is called whenever a part of
+// an image that is loaded in the background becomes available.
+func NewTextureFromFile(r Renderer, file string, orientation Orientation, notify func()) (*Texture, error) {
+	source, err := OpenPyramidSource(file)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading texture: %s", err)
+	}
+	if source != nil {
+		// the tiles are drawn as stored, so the texture keeps the default
+		// orientation and pixel positions map to the file unchanged
+		if orientation != DefaultOrientation {
+			log.Printf("ignoring orientation %d, it is not supported for tiled images", orientation.ExifValue())
+		}
+		return NewTextureFromPyramid(source, notify), nil
+	}
+
+	if IsHighBitDepthFile(file) {
+		i, err := LoadFloatImage(file)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading texture: %s", err)
+		}
+		t := NewTextureFromFloatImage(r, i.Orient(orientation))
+		t.Orientation = orientation
+		return t, nil
+	}
+
 	surface, err := img.Load(file)
 	if err != nil {
 		return nil, fmt.Errorf("error while loading texture: %s", err)
@@ -62,47 +158,79 @@ func NewTextureFromFile(file string, orientation Orientation) (*Texture, error)
 		surface = gfx.RotateSurface90Degrees(surface, orientation.numRotations)
 	}
 
-	return NewTextureFromSurface(surface), nil
+	t, err := NewTextureFromSurface(r, surface)
+	if err != nil {
+		return nil, err
+	}
+	t.Orientation = orientation
+	return t, nil
 }
 
-func (t *Texture) Bind() {
-	gl.BindTexture(gl.TEXTURE_2D, t.Id)
+// Bounds returns the screen area of the texture centered at x, y.
+func (t *Texture) Bounds(x, y, scale float64) Rect {
+	return NewRect(x-scale*t.W/2, y-scale*t.H/2, scale*t.W, scale*t.H)
 }
 
-func (t *Texture) Draw(x, y float64) {
-	t.DrawScale(x, y, 1)
+func (t *Texture) Draw(r Renderer, x, y float64, options ImageOptions) {
+	t.DrawScale(r, x, y, 1, options)
 }
 
-func (t *Texture) DrawScale(x, y, scale float64) {
-	gl.ActiveTexture(gl.TEXTURE0)
-	t.Bind()
-
-	gX := gl.Float(x - scale*t.W/2)
-	gY := gl.Float(y - scale*t.H/2)
-	gX2 := gX + gl.Float(scale*t.W)
-	gY2 := gY + gl.Float(scale*t.H)
-
-	gl.Color4f(1, 1, 1, 1)
-
-	gl.Begin(gl.QUADS)
-
-	gl.TexCoord2f(0, 0)
-	gl.Vertex3f(gX, gY, 0)
+func (t *Texture) DrawScale(r Renderer, x, y, scale float64, options ImageOptions) {
+	t.DrawScaleClipped(r, x, y, scale, t.Bounds(x, y, scale), options)
+}
 
-	gl.TexCoord2f(1, 0)
-	gl.Vertex3f(gX2, gY, 0)
+// DrawScaleClipped draws the texture centered at x, y, skipping the tiles
+// that fall outside of clip. The linear flag and profile of the texture
+// override those in options.
+func (t *Texture) DrawScaleClipped(r Renderer, x, y, scale float64, clip Rect, options ImageOptions) {
+	options.Linear = t.Linear
+	options.Profile = t.Profile
 
-	gl.TexCoord2f(1, 1)
-	gl.Vertex3f(gX2, gY2, 0)
+	bounds := t.Bounds(x, y, scale)
+	if t.pyramid != nil {
+		t.pyramid.draw(r, t, bounds, scale, clip, options)
+	}
+	for _, tile := range t.Tiles {
+		rect := tile.screenRect(bounds, scale)
+		if !rect.Intersects(clip) {
+			continue
+		}
+		r.DrawImage(tile.Image, tile.Source, rect, options)
+	}
+}
 
-	gl.TexCoord2f(0, 1)
-	gl.Vertex3f(gX, gY2, 0)
+// BeginFrame has to be called before a texture is drawn in a frame, which
+// may happen several times, and EndFrame after. Pyramids upload the tiles
+// loaded in the meantime and request the tiles of all draws together.
+func (t *Texture) BeginFrame(r Renderer) {
+	if t.pyramid != nil {
+		t.pyramid.beginFrame(r)
+	}
+}
 
-	gl.End()
+func (t *Texture) EndFrame() {
+	if t.pyramid != nil {
+		t.pyramid.endFrame()
+	}
+}
 
-	gl.BindTexture(gl.TEXTURE_2D, 0)
+func (t TextureTile) screenRect(bounds Rect, scale float64) Rect {
+	return NewRect(
+		bounds.X+t.Rect.X*scale,
+		bounds.Y+t.Rect.Y*scale,
+		t.Rect.W*scale,
+		t.Rect.H*scale,
+	)
 }
 
 func (t *Texture) Destroy() {
-	gl.DeleteTextures(1, &t.Id)
+	for _, tile := range t.Tiles {
+		tile.Image.Destroy()
+	}
+	t.Tiles = nil
+
+	if t.pyramid != nil {
+		t.pyramid.destroy()
+		t.pyramid = nil
+	}
 }
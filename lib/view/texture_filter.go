@@ -0,0 +1,45 @@
+package view
+
+import "fmt"
+
+type TextureFilter int
+
+const (
+	TextureFilterAuto TextureFilter = iota
+	TextureFilterNearest
+	TextureFilterLinear
+
+	textureFilterCount
+)
+
+var textureFilterNames = map[TextureFilter]string{
+	TextureFilterAuto:    "auto",
+	TextureFilterNearest: "nearest",
+	TextureFilterLinear:  "linear",
+}
+
+func (f TextureFilter) String() string {
+	name, ok := textureFilterNames[f]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(f))
+	}
+	return name
+}
+
+func (f TextureFilter) Next() TextureFilter {
+	return (f + 1) % textureFilterCount
+}
+
+// Sampling selects how the texture is sampled at the given scale. In auto
+// mode magnified images switch to nearest sampling once the scale reaches
+// nearestThreshold, so individual pixels stay sharp.
+func (f TextureFilter) Sampling(scale, nearestThreshold float64) Sampling {
+	switch {
+	case f == TextureFilterNearest:
+		return SamplingNearest
+	case f == TextureFilterAuto && scale >= nearestThreshold:
+		return SamplingNearestMagnified
+	default:
+		return SamplingLinear
+	}
+}
@@ -0,0 +1,558 @@
+package view
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagSamplesPerPixel = 277
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagTileByteCounts  = 325
+	tiffTagSubIFDs         = 330
+	tiffTagExtraSamples    = 338
+	tiffTagJPEGTables      = 347
+)
+
+const (
+	tiffPhotometricMinIsWhite = 0
+	tiffPhotometricMinIsBlack = 1
+	tiffPhotometricRGB        = 2
+	tiffPhotometricYCbCr      = 6
+)
+
+// values of ExtraSamples
+const (
+	tiffExtraUnspecified = 0
+	tiffExtraAssociated  = 1
+	tiffExtraStraight    = 2
+)
+
+const (
+	tiffCompressionNone         = 1
+	tiffCompressionJPEG         = 7
+	tiffCompressionDeflate      = 8
+	tiffCompressionAdobeDeflate = 32946
+)
+
+// tiffTileMargin allows compressed tiles to be larger than their pixels,
+// which happens for noisy jpeg and deflate data, plus room for headers
+const (
+	tiffTileMargin      = 2
+	tiffTileHeaderBytes = 1024
+)
+
+// TIFFPyramidSource reads tiled TIFF and BigTIFF files. Every tiled image
+// directory with the aspect ratio of the first one is used as a level, which
+// covers both chained and SubIFD based pyramids.
+type TIFFPyramidSource struct {
+	file   *os.File
+	size   int64
+	levels []PyramidLevel
+	images []tiffImage
+}
+
+type tiffImage struct {
+	width, height         int
+	tileWidth, tileHeight int
+	bitsPerSample         int
+	samplesPerPixel       int
+	photometric           int
+	extraSamples          []uint64
+	compression           int
+	predictor             int
+	planarConfig          int
+	tileOffsets           []uint64
+	tileByteCounts        []uint64
+	jpegTables            []byte
+}
+
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	big   bool
+}
+
+func NewTIFFPyramidSource(filename string) (*TIFFPyramidSource, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening file: %s", err)
+	}
+
+	images, err := readTIFFImages(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error while opening file: %s", err)
+	}
+
+	source := &TIFFPyramidSource{file: f, size: stat.Size()}
+
+	for _, i := range images {
+		if i.tileWidth == 0 || i.tileHeight == 0 {
+			continue
+		}
+		if i.bitsPerSample != 8 || i.planarConfig != 1 {
+			continue
+		}
+		// CMYK, palette and other color spaces are not supported
+		if i.samplesPerPixel < 1 || i.colorSamples() == 0 {
+			continue
+		}
+		if i.compression != tiffCompressionJPEG && i.samplesPerPixel < i.colorSamples() {
+			continue
+		}
+		switch i.compression {
+		case tiffCompressionNone, tiffCompressionJPEG, tiffCompressionDeflate, tiffCompressionAdobeDeflate:
+		default:
+			continue
+		}
+		if len(source.images) != 0 {
+			// labels and overview images of slide scans have other proportions
+			first := source.images[0]
+			ratio := float64(first.width) / float64(first.height)
+			if d := ratio - float64(i.width)/float64(i.height); d > 0.01 || d < -0.01 {
+				continue
+			}
+		}
+		source.images = append(source.images, i)
+	}
+
+	if len(source.images) == 0 {
+		f.Close()
+		return nil, fmt.Errorf("no supported tiled images in tiff")
+	}
+
+	sort.SliceStable(source.images, func(a, b int) bool {
+		return source.images[a].width > source.images[b].width
+	})
+	for _, i := range source.images {
+		source.levels = append(source.levels, PyramidLevel{
+			W:     i.width,
+			H:     i.height,
+			TileW: i.tileWidth,
+			TileH: i.tileHeight,
+		})
+	}
+
+	return source, nil
+}
+
+func readTIFFImages(f io.ReaderAt) ([]tiffImage, error) {
+	header := make([]byte, 16)
+	_, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	t := &tiffReader{r: f, order: binary.LittleEndian}
+	switch string(header[0:2]) {
+	case "II":
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a tiff file")
+	}
+
+	var offset uint64
+	switch t.order.Uint16(header[2:]) {
+	case 42:
+		offset = uint64(t.order.Uint32(header[4:]))
+	case 43:
+		t.big = true
+		offset = t.order.Uint64(header[8:])
+	default:
+		return nil, fmt.Errorf("not a tiff file")
+	}
+
+	var images []tiffImage
+	visited := map[uint64]bool{}
+	for offset != 0 && !visited[offset] {
+		visited[offset] = true
+
+		entries, next, err := t.readIFD(offset)
+		if err != nil {
+			return nil, err
+		}
+		i, subIFDs, err := t.parseImage(entries)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, i)
+
+		for _, subOffset := range subIFDs {
+			subEntries, _, err := t.readIFD(subOffset)
+			if err != nil {
+				return nil, err
+			}
+			sub, _, err := t.parseImage(subEntries)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, sub)
+		}
+
+		offset = next
+	}
+
+	return images, nil
+}
+
+type tiffEntry struct {
+	tag, dataType uint16
+	count         uint64
+	value         []byte
+}
+
+func (t *tiffReader) readIFD(offset uint64) ([]tiffEntry, uint64, error) {
+	countSize, entrySize, valueSize := 2, 12, 4
+	if t.big {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
+	countBytes := make([]byte, countSize)
+	_, err := t.r.ReadAt(countBytes, int64(offset))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while reading tiff directory: %s", err)
+	}
+	count := uint64(0)
+	if t.big {
+		count = t.order.Uint64(countBytes)
+	} else {
+		count = uint64(t.order.Uint16(countBytes))
+	}
+	if count > 4096 {
+		return nil, 0, fmt.Errorf("invalid tiff directory")
+	}
+
+	data := make([]byte, int(count)*entrySize+valueSize)
+	_, err = t.r.ReadAt(data, int64(offset)+int64(countSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while reading tiff directory: %s", err)
+	}
+
+	entries := make([]tiffEntry, count)
+	for n := range entries {
+		e := data[n*entrySize:]
+		entry := tiffEntry{
+			tag:      t.order.Uint16(e[0:]),
+			dataType: t.order.Uint16(e[2:]),
+		}
+		var field []byte
+		if t.big {
+			entry.count = t.order.Uint64(e[4:])
+			field = e[12 : 12+valueSize]
+		} else {
+			entry.count = uint64(t.order.Uint32(e[4:]))
+			field = e[8 : 8+valueSize]
+		}
+
+		size := entry.count * uint64(tiffTypeSize(entry.dataType))
+		if size > 1<<28 {
+			return nil, 0, fmt.Errorf("invalid tiff tag size")
+		}
+		if size <= uint64(valueSize) {
+			entry.value = field[:size]
+		} else {
+			var valueOffset uint64
+			if t.big {
+				valueOffset = t.order.Uint64(field)
+			} else {
+				valueOffset = uint64(t.order.Uint32(field))
+			}
+			entry.value = make([]byte, size)
+			_, err = t.r.ReadAt(entry.value, int64(valueOffset))
+			if err != nil {
+				return nil, 0, fmt.Errorf("error while reading tiff tag %d: %s", entry.tag, err)
+			}
+		}
+		entries[n] = entry
+	}
+
+	next := data[int(count)*entrySize:]
+	if t.big {
+		return entries, t.order.Uint64(next), nil
+	}
+	return entries, uint64(t.order.Uint32(next)), nil
+}
+
+func tiffTypeSize(dataType uint16) int {
+	switch dataType {
+	case 3, 8:
+		return 2
+	case 4, 9, 11, 13:
+		return 4
+	case 5, 10, 12, 16, 17, 18:
+		return 8
+	}
+	return 1
+}
+
+func (t *tiffReader) values(e tiffEntry) []uint64 {
+	size := tiffTypeSize(e.dataType)
+	result := make([]uint64, 0, e.count)
+	for i := 0; i+size <= len(e.value); i += size {
+		switch size {
+		case 2:
+			result = append(result, uint64(t.order.Uint16(e.value[i:])))
+		case 4:
+			result = append(result, uint64(t.order.Uint32(e.value[i:])))
+		case 8:
+			result = append(result, t.order.Uint64(e.value[i:]))
+		default:
+			result = append(result, uint64(e.value[i]))
+		}
+	}
+	return result
+}
+
+func (t *tiffReader) parseImage(entries []tiffEntry) (tiffImage, []uint64, error) {
+	i := tiffImage{
+		bitsPerSample:   1,
+		samplesPerPixel: 1,
+		compression:     tiffCompressionNone,
+		predictor:       1,
+		planarConfig:    1,
+		photometric:     -1,
+	}
+	var subIFDs []uint64
+
+	first := func(e tiffEntry) int {
+		values := t.values(e)
+		if len(values) == 0 {
+			return 0
+		}
+		return int(values[0])
+	}
+
+	for _, e := range entries {
+		switch e.tag {
+		case tiffTagImageWidth:
+			i.width = first(e)
+		case tiffTagImageLength:
+			i.height = first(e)
+		case tiffTagBitsPerSample:
+			i.bitsPerSample = first(e)
+		case tiffTagCompression:
+			i.compression = first(e)
+		case tiffTagSamplesPerPixel:
+			i.samplesPerPixel = first(e)
+		case tiffTagPhotometric:
+			i.photometric = first(e)
+		case tiffTagExtraSamples:
+			i.extraSamples = t.values(e)
+		case tiffTagPlanarConfig:
+			i.planarConfig = first(e)
+		case tiffTagPredictor:
+			i.predictor = first(e)
+		case tiffTagTileWidth:
+			i.tileWidth = first(e)
+		case tiffTagTileLength:
+			i.tileHeight = first(e)
+		case tiffTagTileOffsets:
+			i.tileOffsets = t.values(e)
+		case tiffTagTileByteCounts:
+			i.tileByteCounts = t.values(e)
+		case tiffTagSubIFDs:
+			subIFDs = t.values(e)
+		case tiffTagJPEGTables:
+			i.jpegTables = e.value
+		}
+	}
+
+	// the tag is required, files without it are read by their samples
+	if i.photometric < 0 {
+		i.photometric = tiffPhotometricMinIsBlack
+		if i.samplesPerPixel >= 3 {
+			i.photometric = tiffPhotometricRGB
+		}
+	}
+
+	if i.tileWidth != 0 && (i.width <= 0 || i.height <= 0 || len(i.tileOffsets) != len(i.tileByteCounts)) {
+		return i, nil, fmt.Errorf("invalid tiled tiff image")
+	}
+
+	return i, subIFDs, nil
+}
+
+func (s *TIFFPyramidSource) Levels() []PyramidLevel {
+	return s.levels
+}
+
+func (s *TIFFPyramidSource) LoadTile(level, column, row int) (*image.NRGBA, Rect, error) {
+	i := s.images[level]
+	l := s.levels[level]
+
+	index := row*l.Columns() + column
+	n, err := i.tileSize(index, s.size)
+	if err != nil {
+		return nil, Rect{}, err
+	}
+
+	data := make([]byte, n)
+	_, err = s.file.ReadAt(data, int64(i.tileOffsets[index]))
+	if err != nil {
+		return nil, Rect{}, fmt.Errorf("error while reading tile: %s", err)
+	}
+
+	tile, err := i.decodeTile(data)
+	if err != nil {
+		return nil, Rect{}, err
+	}
+
+	// edge tiles are padded to the full tile size
+	x := column * i.tileWidth
+	y := row * i.tileHeight
+	w := min(i.tileWidth, i.width-x)
+	h := min(i.tileHeight, i.height-y)
+	if tile.Rect.Dx() > w || tile.Rect.Dy() > h {
+		tile = toNRGBA(tile.SubImage(image.Rect(0, 0, w, h)))
+	}
+
+	return tile, NewRect(float64(x), float64(y), float64(w), float64(h)), nil
+}
+
+// tileSize returns the byte count of a tile, which is checked against the
+// file size and the size of its pixels before it is allocated
+func (i tiffImage) tileSize(index int, fileSize int64) (int, error) {
+	if index < 0 || index >= len(i.tileOffsets) {
+		return 0, fmt.Errorf("tile out of range")
+	}
+
+	n := i.tileByteCounts[index]
+	pixels := uint64(i.tileWidth) * uint64(i.tileHeight) * uint64(i.samplesPerPixel) * uint64(i.bitsPerSample) / 8
+	if n > tiffTileMargin*pixels+tiffTileHeaderBytes {
+		return 0, fmt.Errorf("tile too large: %d bytes", n)
+	}
+	offset := i.tileOffsets[index]
+	if offset > uint64(fileSize) || n > uint64(fileSize)-offset {
+		return 0, fmt.Errorf("tile beyond end of file")
+	}
+	return int(n), nil
+}
+
+// colorSamples returns the number of color samples of a pixel, before any
+// extra samples, or 0 when the photometric interpretation is not supported
+func (i tiffImage) colorSamples() int {
+	switch i.photometric {
+	case tiffPhotometricMinIsWhite, tiffPhotometricMinIsBlack:
+		return 1
+	case tiffPhotometricRGB:
+		return 3
+	case tiffPhotometricYCbCr:
+		// only converted by the jpeg decoder
+		if i.compression == tiffCompressionJPEG {
+			return 3
+		}
+	}
+	return 0
+}
+
+// alpha returns the type of the first extra sample, which is the only one
+// that can be alpha
+func (i tiffImage) alpha() int {
+	if len(i.extraSamples) == 0 || i.samplesPerPixel <= i.colorSamples() {
+		return tiffExtraUnspecified
+	}
+	return int(i.extraSamples[0])
+}
+
+func (i tiffImage) decodeTile(data []byte) (*image.NRGBA, error) {
+	switch i.compression {
+	case tiffCompressionJPEG:
+		// shared tables are stored once, without the tile's start of image
+		if len(i.jpegTables) > 4 && len(data) > 2 {
+			data = append(append([]byte{}, i.jpegTables[:len(i.jpegTables)-2]...), data[2:]...)
+		}
+		tile, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding jpeg tile: %s", err)
+		}
+		return toNRGBA(tile), nil
+
+	case tiffCompressionDeflate, tiffCompressionAdobeDeflate:
+		z, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding deflate tile: %s", err)
+		}
+		data, err = io.ReadAll(z)
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding deflate tile: %s", err)
+		}
+	}
+
+	samples := i.samplesPerPixel
+	colors := i.colorSamples()
+	if colors == 0 || samples < colors {
+		return nil, fmt.Errorf("unsupported tiff samples")
+	}
+	stride := i.tileWidth * samples
+	if len(data) < stride*i.tileHeight {
+		return nil, fmt.Errorf("tile data too short")
+	}
+
+	// horizontal differencing
+	if i.predictor == 2 {
+		for y := 0; y < i.tileHeight; y++ {
+			line := data[y*stride : (y+1)*stride]
+			for x := samples; x < len(line); x++ {
+				line[x] += line[x-samples]
+			}
+		}
+	}
+
+	alpha := i.alpha()
+	tile := image.NewNRGBA(image.Rect(0, 0, i.tileWidth, i.tileHeight))
+	for p := 0; p < i.tileWidth*i.tileHeight; p++ {
+		src := data[p*samples:]
+		dst := tile.Pix[p*4:]
+		if colors == 3 {
+			copy(dst[:3], src[:3])
+		} else {
+			v := src[0]
+			if i.photometric == tiffPhotometricMinIsWhite {
+				v = 0xff - v
+			}
+			dst[0], dst[1], dst[2] = v, v, v
+		}
+
+		dst[3] = 0xff
+		if alpha == tiffExtraAssociated || alpha == tiffExtraStraight {
+			dst[3] = src[colors]
+		}
+		// premultiplied colors are divided by alpha, rounded
+		if alpha == tiffExtraAssociated && dst[3] != 0 && dst[3] != 0xff {
+			a := int(dst[3])
+			for c := 0; c < 3; c++ {
+				dst[c] = uint8(min(0xff, (int(dst[c])*0xff+a/2)/a))
+			}
+		}
+	}
+
+	return tile, nil
+}
+
+func (s *TIFFPyramidSource) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,154 @@
+package view
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTIFFDecodeTile(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    tiffImage
+		data     []byte
+		expected []byte
+	}{
+		{
+			"min is black",
+			tiffImage{samplesPerPixel: 1, photometric: tiffPhotometricMinIsBlack},
+			[]byte{10, 200},
+			[]byte{10, 10, 10, 255, 200, 200, 200, 255},
+		},
+		{
+			"min is white",
+			tiffImage{samplesPerPixel: 1, photometric: tiffPhotometricMinIsWhite},
+			[]byte{0, 200},
+			[]byte{255, 255, 255, 255, 55, 55, 55, 255},
+		},
+		{
+			"gray with alpha",
+			tiffImage{samplesPerPixel: 2, photometric: tiffPhotometricMinIsBlack, extraSamples: []uint64{tiffExtraStraight}},
+			[]byte{10, 128, 200, 0},
+			[]byte{10, 10, 10, 128, 200, 200, 200, 0},
+		},
+		{
+			"rgb",
+			tiffImage{samplesPerPixel: 3, photometric: tiffPhotometricRGB},
+			[]byte{1, 2, 3, 4, 5, 6},
+			[]byte{1, 2, 3, 255, 4, 5, 6, 255},
+		},
+		{
+			"rgb with straight alpha",
+			tiffImage{samplesPerPixel: 4, photometric: tiffPhotometricRGB, extraSamples: []uint64{tiffExtraStraight}},
+			[]byte{50, 25, 0, 128, 4, 5, 6, 0},
+			[]byte{50, 25, 0, 128, 4, 5, 6, 0},
+		},
+		{
+			"rgb with associated alpha",
+			tiffImage{samplesPerPixel: 4, photometric: tiffPhotometricRGB, extraSamples: []uint64{tiffExtraAssociated}},
+			[]byte{50, 25, 0, 128, 0, 0, 0, 0},
+			[]byte{100, 50, 0, 128, 0, 0, 0, 0},
+		},
+		{
+			"rgb with unspecified extra sample",
+			tiffImage{samplesPerPixel: 4, photometric: tiffPhotometricRGB, extraSamples: []uint64{tiffExtraUnspecified}},
+			[]byte{1, 2, 3, 9, 4, 5, 6, 9},
+			[]byte{1, 2, 3, 255, 4, 5, 6, 255},
+		},
+		{
+			"rgb with alpha without extra samples tag",
+			tiffImage{samplesPerPixel: 4, photometric: tiffPhotometricRGB},
+			[]byte{1, 2, 3, 9, 4, 5, 6, 9},
+			[]byte{1, 2, 3, 255, 4, 5, 6, 255},
+		},
+		{
+			"horizontal differencing",
+			tiffImage{samplesPerPixel: 3, photometric: tiffPhotometricRGB, predictor: 2},
+			[]byte{1, 2, 3, 4, 5, 6},
+			[]byte{1, 2, 3, 255, 5, 7, 9, 255},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := test.image
+			i.tileWidth, i.tileHeight = 2, 1
+			i.compression = tiffCompressionNone
+
+			tile, err := i.decodeTile(test.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(tile.Pix, test.expected) {
+				t.Errorf("pixels are %v, expected %v", tile.Pix, test.expected)
+			}
+		})
+	}
+}
+
+func TestTIFFUnsupportedSamples(t *testing.T) {
+	tests := []struct {
+		name  string
+		image tiffImage
+	}{
+		{"no samples", tiffImage{samplesPerPixel: 0, photometric: tiffPhotometricMinIsBlack}},
+		{"fewer samples than colors", tiffImage{samplesPerPixel: 2, photometric: tiffPhotometricRGB}},
+		{"cmyk", tiffImage{samplesPerPixel: 4, photometric: 5}},
+		{"palette", tiffImage{samplesPerPixel: 1, photometric: 3}},
+		{"uncompressed ycbcr", tiffImage{samplesPerPixel: 3, photometric: tiffPhotometricYCbCr}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := test.image
+			i.tileWidth, i.tileHeight = 2, 1
+			i.compression = tiffCompressionNone
+
+			_, err := i.decodeTile(nil)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestTIFFTileSize(t *testing.T) {
+	i := tiffImage{
+		tileWidth:       16,
+		tileHeight:      16,
+		bitsPerSample:   8,
+		samplesPerPixel: 3,
+		tileOffsets:     []uint64{8, 8, 8000, 8, 1 << 62},
+		tileByteCounts:  []uint64{768, 2560, 500, 4000, 100},
+	}
+
+	tests := []struct {
+		name     string
+		index    int
+		expected int
+	}{
+		{"uncompressed", 0, 768},
+		{"compressed larger than pixels", 1, 2560},
+		{"beyond end of file", 2, -1},
+		{"too large", 3, -1},
+		{"offset beyond end of file", 4, -1},
+		{"out of range", 5, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := i.tileSize(test.index, 8192)
+			if test.expected < 0 {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if n != test.expected {
+				t.Errorf("size is %d, expected %d", n, test.expected)
+			}
+		})
+	}
+}
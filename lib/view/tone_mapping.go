@@ -0,0 +1,71 @@
+package view
+
+import (
+	"fmt"
+	"math"
+)
+
+type ToneMapOperator int
+
+const (
+	ToneMapClamp ToneMapOperator = iota
+	ToneMapReinhard
+	ToneMapACES
+
+	toneMapOperatorCount
+)
+
+var toneMapOperatorNames = map[ToneMapOperator]string{
+	ToneMapClamp:    "clamp",
+	ToneMapReinhard: "Reinhard",
+	ToneMapACES:     "ACES",
+}
+
+func (o ToneMapOperator) String() string {
+	name, ok := toneMapOperatorNames[o]
+	if !ok {
+		return fmt.Sprintf("unknown (%d)", int(o))
+	}
+	return name
+}
+
+func (o ToneMapOperator) Next() ToneMapOperator {
+	return (o + 1) % toneMapOperatorCount
+}
+
+type ToneMapping struct {
+	Exposure float64
+	Operator ToneMapOperator
+}
+
+const (
+	MinExposure = -10.0
+	MaxExposure = 10.0
+)
+
+func (t *ToneMapping) AdjustExposure(ev float64) {
+	t.Exposure = min(max(t.Exposure+ev, MinExposure), MaxExposure)
+}
+
+func (t *ToneMapping) IsDefault() bool {
+	return t.Exposure == 0 && t.Operator == ToneMapClamp
+}
+
+func (t *ToneMapping) String() string {
+	return fmt.Sprintf("EV %+.1f %s", t.Exposure, t.Operator)
+}
+
+// Map applies the exposure and tone curve to a linear light value, matching
+// the image shader.
+func (t *ToneMapping) Map(c float64) float64 {
+	c *= math.Exp2(t.Exposure)
+
+	switch t.Operator {
+	case ToneMapReinhard:
+		return c / (1 + c)
+	case ToneMapACES:
+		c *= 0.6
+		return (c * (2.51*c + 0.03)) / (c*(2.43*c+0.59) + 0.14)
+	}
+	return c
+}
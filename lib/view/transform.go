@@ -0,0 +1,82 @@
+package view
+
+import "math"
+
+// Transform is a 2D affine transformation, mapping x, y to
+// x*A + y*C + E, x*B + y*D + F.
+type Transform struct {
+	A, B, C, D, E, F float64
+}
+
+var IdentityTransform = Transform{A: 1, D: 1}
+
+func TranslateTransform(x, y float64) Transform {
+	return Transform{A: 1, D: 1, E: x, F: y}
+}
+
+func ScaleTransform(x, y float64) Transform {
+	return Transform{A: x, D: y}
+}
+
+// RotateTransform rotates clockwise on screen, as the y axis points down
+func RotateTransform(degrees float64) Transform {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return Transform{A: cos, B: sin, C: -sin, D: cos}
+}
+
+// Then returns the transformation applying t first and o second
+func (t Transform) Then(o Transform) Transform {
+	return Transform{
+		A: t.A*o.A + t.B*o.C,
+		B: t.A*o.B + t.B*o.D,
+		C: t.C*o.A + t.D*o.C,
+		D: t.C*o.B + t.D*o.D,
+		E: t.E*o.A + t.F*o.C + o.E,
+		F: t.E*o.B + t.F*o.D + o.F,
+	}
+}
+
+func (t Transform) Apply(x, y float64) (float64, float64) {
+	return x*t.A + y*t.C + t.E, x*t.B + y*t.D + t.F
+}
+
+func (t Transform) Invert() Transform {
+	det := t.A*t.D - t.B*t.C
+	return Transform{
+		A: t.D / det,
+		B: -t.B / det,
+		C: -t.C / det,
+		D: t.A / det,
+		E: (t.C*t.F - t.D*t.E) / det,
+		F: (t.B*t.E - t.A*t.F) / det,
+	}
+}
+
+// Scale returns the factor by which lengths grow
+func (t Transform) Scale() float64 {
+	return math.Sqrt(math.Abs(t.A*t.D - t.B*t.C))
+}
+
+// Corners returns the transformed corners of a rect, in the order top left,
+// top right, bottom left, bottom right of the untransformed rect.
+func (t Transform) Corners(r Rect) [4][2]float64 {
+	var corners [4][2]float64
+	for i, corner := range [4][2]float64{{r.X, r.Y}, {r.X2(), r.Y}, {r.X, r.Y2()}, {r.X2(), r.Y2()}} {
+		corners[i][0], corners[i][1] = t.Apply(corner[0], corner[1])
+	}
+	return corners
+}
+
+// BoundingRect returns the smallest rect containing the transformed rect
+func (t Transform) BoundingRect(r Rect) Rect {
+	corners := t.Corners(r)
+	left, top := corners[0][0], corners[0][1]
+	right, bottom := left, top
+	for _, corner := range corners[1:] {
+		left = math.Min(left, corner[0])
+		top = math.Min(top, corner[1])
+		right = math.Max(right, corner[0])
+		bottom = math.Max(bottom, corner[1])
+	}
+	return NewRect(left, top, right-left, bottom-top)
+}
@@ -0,0 +1,88 @@
+package view
+
+import "math"
+
+// View is the placement of the image in the window: centered at X, Y and
+// scaled, then flipped and rotated around that center.
+type View struct {
+	X, Y  float64
+	W, H  float64
+	Scale float64
+
+	// Rotation is in degrees, clockwise
+	Rotation     float64
+	FlipH, FlipV bool
+}
+
+// Transform maps the unrotated image, drawn centered at X, Y, to the window
+func (v *View) Transform() Transform {
+	flipX, flipY := 1.0, 1.0
+	if v.FlipH {
+		flipX = -1
+	}
+	if v.FlipV {
+		flipY = -1
+	}
+
+	return TranslateTransform(-v.X, -v.Y).
+		Then(ScaleTransform(flipX, flipY)).
+		Then(RotateTransform(v.Rotation)).
+		Then(TranslateTransform(v.X, v.Y))
+}
+
+// Rotate turns the image clockwise
+func (v *View) Rotate(degrees float64) {
+	v.Rotation = math.Mod(v.Rotation+degrees, 360)
+	if v.Rotation < 0 {
+		v.Rotation += 360
+	}
+}
+
+// FlipHorizontal mirrors the image along the vertical axis of the window,
+// whatever its rotation is
+func (v *View) FlipHorizontal() {
+	v.FlipH = !v.FlipH
+	v.Rotate(-2 * v.Rotation)
+}
+
+// FlipVertical mirrors the image along the horizontal axis of the window
+func (v *View) FlipVertical() {
+	v.FlipV = !v.FlipV
+	v.Rotate(-2 * v.Rotation)
+}
+
+func (v *View) ResetTransform() {
+	v.Rotation = 0
+	v.FlipH = false
+	v.FlipV = false
+}
+
+// RotatedSize returns the size of the bounding box of a w by h image after
+// rotation, in image pixels
+func (v *View) RotatedSize(w, h float64) (float64, float64) {
+	sin, cos := math.Sincos(v.Rotation * math.Pi / 180)
+	sin, cos = math.Abs(sin), math.Abs(cos)
+	return w*cos + h*sin, w*sin + h*cos
+}
+
+// Orientation returns the flips and rotation as exif style orientation, which
+// is only possible for multiples of 90 degrees
+func (v *View) Orientation() (Orientation, bool) {
+	quarters := math.Round(v.Rotation / 90)
+	if math.Abs(v.Rotation-quarters*90) > 1e-6 {
+		return DefaultOrientation, false
+	}
+
+	// a vertical flip is a horizontal one turned upside down
+	flip := DefaultOrientation
+	switch {
+	case v.FlipH && v.FlipV:
+		flip = Orientation{false, 2}
+	case v.FlipH:
+		flip = Orientation{true, 0}
+	case v.FlipV:
+		flip = Orientation{true, 2}
+	}
+
+	return flip.Then(Orientation{false, int(quarters) % 4}), true
+}
@@ -0,0 +1,207 @@
+package view
+
+import (
+	"math"
+	"time"
+)
+
+// KineticStopSpeed is the speed in pixels per second below which kinetic
+// panning stops
+const KineticStopSpeed = 20
+
+// kineticIdleTime is the time without movement after which releasing a drag
+// does not start kinetic panning
+const kineticIdleTime = 100 * time.Millisecond
+
+// zoomAnimation eases the scale towards a target. While continuous it keeps
+// zooming after reaching the target, for as long as a zoom key is held.
+type zoomAnimation struct {
+	// x, y is the window position that stays in place, unless the zoom is
+	// around the center of the image
+	x, y   float64
+	center bool
+
+	from, to float64
+	start    time.Time
+	duration time.Duration
+
+	continuous bool
+	factor     float64
+	stopped    bool
+}
+
+func (a *zoomAnimation) Animate(m *Main, now time.Time) bool {
+	if a.stopped {
+		return false
+	}
+
+	t := 1.0
+	if a.duration > 0 {
+		t = float64(now.Sub(a.start)) / float64(a.duration)
+	}
+
+	var scale float64
+	switch {
+	case t < 1:
+		scale = a.from * math.Pow(a.to/a.from, easeOut(t))
+	case a.continuous:
+		// one zoom step per duration
+		scale = a.to * math.Pow(a.factor, t-1)
+	default:
+		scale = a.to
+	}
+
+	x, y := a.x, a.y
+	if a.center {
+		x, y = m.View.X, m.View.Y
+	}
+	m.ZoomAt(x, y, scale/m.View.Scale)
+	m.ConstrainView()
+
+	if t < 1 || a.continuous {
+		return true
+	}
+	m.zoom = nil
+	return false
+}
+
+// easeOut starts fast and slows down towards the end, t is in 0..1
+func easeOut(t float64) float64 {
+	return 1 - math.Pow(1-t, 3)
+}
+
+// AnimateZoom zooms by factor around the window position x, y, or the center
+// of the image, over ZoomDuration. A zoom during a running zoom continues from
+// the current scale towards the combined target. A continuous zoom goes on
+// until StopZoom is called.
+func (m *Main) AnimateZoom(x, y float64, center bool, factor float64, continuous bool) {
+	now := time.Now()
+	to := m.View.Scale * factor
+	if m.zoom != nil {
+		m.zoom.stopped = true
+		if !m.zoom.continuous {
+			to = m.zoom.to * factor
+		}
+	}
+
+	m.zoom = &zoomAnimation{
+		x:          x,
+		y:          y,
+		center:     center,
+		from:       m.View.Scale,
+		to:         m.clampScale(to),
+		start:      now,
+		duration:   time.Duration(m.Settings.ZoomDuration * float64(time.Second)),
+		continuous: continuous,
+		factor:     factor,
+	}
+	m.StartAnimation(m.zoom)
+}
+
+// StopZoom ends a continuous zoom, a zoom step that is still running
+// finishes
+func (m *Main) StopZoom() {
+	if m.zoom == nil || !m.zoom.continuous {
+		return
+	}
+
+	if time.Since(m.zoom.start) >= m.zoom.duration {
+		m.zoom.stopped = true
+		m.zoom = nil
+		return
+	}
+	m.zoom.continuous = false
+}
+
+// StopViewAnimations stops zooming and panning, for when the view is placed
+// anew
+func (m *Main) StopViewAnimations() {
+	if m.zoom != nil {
+		m.zoom.stopped = true
+		m.zoom = nil
+	}
+	m.StopKineticPan()
+}
+
+// kineticPan keeps the view moving after a drag is released, slowing down
+// with the configured friction
+type kineticPan struct {
+	vx, vy  float64
+	last    time.Time
+	stopped bool
+}
+
+func (a *kineticPan) Animate(m *Main, now time.Time) bool {
+	if a.stopped {
+		return false
+	}
+
+	dt := now.Sub(a.last).Seconds()
+	a.last = now
+	if dt <= 0 {
+		return true
+	}
+
+	x, y := m.View.X+a.vx*dt, m.View.Y+a.vy*dt
+	m.View.X, m.View.Y = x, y
+	m.ConstrainView()
+
+	// stop moving along an axis at the edge
+	if m.View.X != x {
+		a.vx = 0
+	}
+	if m.View.Y != y {
+		a.vy = 0
+	}
+
+	decay := math.Exp(-dt * m.Settings.KineticFriction)
+	a.vx *= decay
+	a.vy *= decay
+
+	if math.Hypot(a.vx, a.vy) >= KineticStopSpeed {
+		return true
+	}
+	m.pan = nil
+	return false
+}
+
+// TrackPan updates the speed of the view while it is dragged, from the
+// movement by dx, dy
+func (m *Main) TrackPan(dx, dy float64) {
+	now := time.Now()
+	dt := now.Sub(m.panTime).Seconds()
+	m.panTime = now
+	if dt <= 0 || dt > kineticIdleTime.Seconds() {
+		m.panVX, m.panVY = 0, 0
+		return
+	}
+
+	// smooth out the jitter of single mouse events
+	weight := math.Min(1, dt/0.05)
+	m.panVX += (dx/dt - m.panVX) * weight
+	m.panVY += (dy/dt - m.panVY) * weight
+}
+
+// StartKineticPan continues the movement of a released drag
+func (m *Main) StartKineticPan() {
+	if m.Settings.KineticFriction <= 0 || time.Since(m.panTime) > kineticIdleTime {
+		return
+	}
+	if math.Hypot(m.panVX, m.panVY) < KineticStopSpeed {
+		return
+	}
+
+	m.pan = &kineticPan{vx: m.panVX, vy: m.panVY, last: time.Now()}
+	m.StartAnimation(m.pan)
+}
+
+// StopKineticPan stops the movement of a released drag, when the view is
+// grabbed again
+func (m *Main) StopKineticPan() {
+	if m.pan != nil {
+		m.pan.stopped = true
+		m.pan = nil
+	}
+	m.panTime = time.Now()
+	m.panVX, m.panVY = 0, 0
+}
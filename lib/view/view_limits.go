@@ -0,0 +1,43 @@
+package view
+
+import "math"
+
+// ZoomAt scales the view by factor around the window position x, y, within
+// the configured zoom limits
+func (m *Main) ZoomAt(x, y, factor float64) {
+	scale := m.clampScale(m.View.Scale * factor)
+	factor = scale / m.View.Scale
+
+	m.View.X += (x - m.View.X) * (1 - factor)
+	m.View.Y += (y - m.View.Y) * (1 - factor)
+	m.View.Scale = scale
+}
+
+func (m *Main) clampScale(scale float64) float64 {
+	return math.Max(m.Settings.MinZoom, math.Min(m.Settings.MaxZoom, scale))
+}
+
+// ConstrainView applies the zoom limits and keeps the image in the window.
+// Images smaller than the window are centered when CenterSmallImages is set,
+// of larger images at least PanMargin pixels stay visible.
+func (m *Main) ConstrainView() {
+	m.View.Scale = m.clampScale(m.View.Scale)
+
+	if m.Texture == nil {
+		return
+	}
+
+	w, h := m.View.RotatedSize(m.Texture.W*m.View.Scale, m.Texture.H*m.View.Scale)
+	m.View.X = m.constrainPan(m.View.X, w, m.View.W)
+	m.View.Y = m.constrainPan(m.View.Y, h, m.View.H)
+}
+
+// constrainPan limits the center of an image of size on one axis of the window
+func (m *Main) constrainPan(center, size, window float64) float64 {
+	if size <= window && m.Settings.CenterSmallImages {
+		return window / 2
+	}
+
+	margin := math.Min(m.Settings.PanMargin, math.Min(size, window))
+	return math.Max(margin-size/2, math.Min(window-margin+size/2, center))
+}
@@ -0,0 +1,34 @@
+package view
+
+// rememberView stores the view of the current file for when it is shown again
+// in this session
+func (m *Main) rememberView() {
+	if !m.Settings.RememberViews || m.Texture == nil || len(m.Filename) == 0 {
+		return
+	}
+	if m.views == nil {
+		m.views = map[string]View{}
+	}
+	m.views[m.Filename] = m.View
+}
+
+// restoreView places a newly loaded file. A locked view is kept as it is,
+// otherwise a remembered view is restored or the file is fitted to the window.
+func (m *Main) restoreView(locked bool) {
+	m.StopViewAnimations()
+
+	if locked {
+		return
+	}
+
+	if v, ok := m.views[m.Filename]; ok && m.Settings.RememberViews {
+		// the window may have been resized since
+		v.W, v.H = m.View.W, m.View.H
+		m.View = v
+		m.ConstrainView()
+		return
+	}
+
+	m.View.ResetTransform()
+	m.Fit(m.Settings.FitMode)
+}
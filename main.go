@@ -1,20 +1,21 @@
 package main
 
 import (
+	"flag"
 	"github.com/DemonTPx/go-view/lib/view"
-	"os"
 	"runtime"
 )
 
 func main() {
 	runtime.LockOSThread()
 
-	filename := ""
-	if len(os.Args) >= 2 {
-		filename = os.Args[1]
-	}
+	compare := flag.String("compare", "", "compare with the files of the same name in this directory")
+	flag.Parse()
+
+	filename := flag.Arg(0)
 
 	main := view.NewMain(filename)
+	main.CompareDirectory = *compare
 	err := main.Run()
 	if err != nil {
 		panic(err)